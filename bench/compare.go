@@ -0,0 +1,221 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// A Comparison compares the results of one benchmark in one unit
+// between an old and a new set of benchmark runs.
+type Comparison struct {
+	// Key identifies the benchmark. It is the benchmark name
+	// followed by its benchmark-line configuration, in the same
+	// form as a benchmark line name, without the "Benchmark"
+	// prefix.
+	Key string
+
+	// Unit is the result unit being compared.
+	Unit string
+
+	// Info describes Unit.
+	Info Unit
+
+	// Old and New are the results of the old and new runs.
+	Old, New *Sample
+
+	// Delta is the relative change from the old mean to the new
+	// mean. It is NaN if the old mean is 0 or either sample is
+	// empty.
+	Delta float64
+
+	// P is the p-value of a two-sided Mann-Whitney U test of
+	// whether Old and New come from the same distribution. It is
+	// NaN if either sample is empty.
+	P float64
+}
+
+// A Sample is a set of results from repeated runs of a benchmark.
+type Sample struct {
+	Values []float64
+
+	// Mean and StdDev are the mean and sample standard deviation
+	// of Values. StdDev is 0 if there is only one value.
+	Mean, StdDev float64
+}
+
+// NewSample returns a Sample of values.
+func NewSample(values []float64) *Sample {
+	s := &Sample{Values: values}
+	if len(values) == 0 {
+		s.Mean, s.StdDev = math.NaN(), math.NaN()
+		return s
+	}
+	for _, v := range values {
+		s.Mean += v
+	}
+	s.Mean /= float64(len(values))
+	if len(values) > 1 {
+		var ss float64
+		for _, v := range values {
+			ss += (v - s.Mean) * (v - s.Mean)
+		}
+		s.StdDev = math.Sqrt(ss / float64(len(values)-1))
+	}
+	return s
+}
+
+// Significant returns whether c's p-value is below alpha.
+func (c *Comparison) Significant(alpha float64) bool {
+	return c.P < alpha
+}
+
+// Change returns 1 if c is a significant improvement at level alpha,
+// -1 if it is a significant regression, and 0 if it is not
+// significant or it is not known whether higher or lower values of
+// c's unit are better.
+func (c *Comparison) Change(alpha float64) int {
+	if !c.Significant(alpha) || math.IsNaN(c.Delta) || c.Delta == 0 {
+		return 0
+	}
+	if c.Delta > 0 {
+		return int(c.Info.Better)
+	}
+	return -int(c.Info.Better)
+}
+
+// Key returns the comparison key of b: its name followed by its
+// benchmark-line configuration in sorted order. Block configuration
+// describes the environment (such as the commit or machine) and
+// typically differs between the sets of results being compared, so
+// it is not part of the key.
+func (b *Benchmark) Key() string {
+	var keys []string
+	for k, c := range b.Config {
+		if !c.InBlock {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	parts := []string{b.Name}
+	for _, k := range keys {
+		parts = append(parts, k+":"+b.Config[k].RawValue)
+	}
+	return strings.Join(parts, "/")
+}
+
+// Compare groups the benchmarks in old and new by Key and compares
+// the results of each group in each unit. It returns a Comparison for
+// every key and unit that appears in either old or new, ordered by
+// unit and then by the order in which keys first appear.
+func Compare(old, new []*Benchmark) []*Comparison {
+	type groupKey struct {
+		key, unit string
+	}
+	var keys, units []string
+	seenKey, infos := map[string]bool{}, map[string]Unit{}
+	values := [2]map[groupKey][]float64{{}, {}}
+	for i, bs := range [][]*Benchmark{old, new} {
+		for _, b := range bs {
+			key := b.Key()
+			if !seenKey[key] {
+				seenKey[key] = true
+				keys = append(keys, key)
+			}
+			for unit, v := range b.Result {
+				if _, ok := infos[unit]; !ok {
+					infos[unit] = b.Unit(unit)
+					units = append(units, unit)
+				}
+				gk := groupKey{key, unit}
+				values[i][gk] = append(values[i][gk], v)
+			}
+		}
+	}
+	sort.Sort(resultKeySorter(units))
+
+	var out []*Comparison
+	for _, unit := range units {
+		for _, key := range keys {
+			gk := groupKey{key, unit}
+			if values[0][gk] == nil && values[1][gk] == nil {
+				continue
+			}
+			c := &Comparison{
+				Key:  key,
+				Unit: unit,
+				Info: infos[unit],
+				Old:  NewSample(values[0][gk]),
+				New:  NewSample(values[1][gk]),
+			}
+			c.Delta = c.New.Mean/c.Old.Mean - 1
+			if c.Old.Mean == 0 {
+				c.Delta = math.NaN()
+			}
+			_, c.P = mannWhitneyUTest(c.Old.Values, c.New.Values)
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// FprintComparisons prints a table of cs to w, with one section per
+// unit. Each row shows the old and new mean and relative standard
+// deviation, and the change in the mean if it is significant at level
+// alpha. Insignificant changes are shown as "~". Values are scaled
+// for display as described by each unit's Info.
+func FprintComparisons(w io.Writer, cs []*Comparison, alpha float64) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	var scale func(float64) float64
+	for i, c := range cs {
+		if i == 0 || c.Unit != cs[i-1].Unit {
+			// Scale the whole section to suit its typical
+			// value.
+			var means []float64
+			for _, c2 := range cs[i:] {
+				if c2.Unit != c.Unit {
+					break
+				}
+				means = append(means, c2.Old.Mean, c2.New.Mean)
+			}
+			var unit string
+			scale, unit = c.Info.Scaler(median(means))
+			if i > 0 {
+				fmt.Fprintf(tw, "\t\t\t\t\t\n")
+			}
+			fmt.Fprintf(tw, "name\told %s\tnew %s\tdelta\t\t\n", unit, unit)
+		}
+		delta := "~"
+		if math.IsNaN(c.P) || math.IsNaN(c.Delta) {
+			delta = ""
+		} else if c.Significant(alpha) {
+			delta = fmt.Sprintf("%+.2f%%", c.Delta*100)
+		}
+		stats := ""
+		if !math.IsNaN(c.P) {
+			stats = fmt.Sprintf("(p=%.3f n=%d+%d)", c.P, len(c.Old.Values), len(c.New.Values))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", c.Key, formatSample(c.Old, scale), formatSample(c.New, scale), delta, stats)
+	}
+	return tw.Flush()
+}
+
+// formatSample formats s as its mean, scaled by scale, and relative
+// standard deviation.
+func formatSample(s *Sample, scale func(float64) float64) string {
+	if len(s.Values) == 0 {
+		return ""
+	}
+	mean := pretty(scale(s.Mean))
+	if s.StdDev == 0 || s.Mean == 0 {
+		return mean
+	}
+	return fmt.Sprintf("%s ±%2.0f%%", mean, math.Abs(s.StdDev/s.Mean)*100)
+}
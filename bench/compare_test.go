@@ -0,0 +1,86 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, s string) []*Benchmark {
+	bs, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bs
+}
+
+func TestCompare(t *testing.T) {
+	old := mustParse(t, `commit: a
+BenchmarkX/gogc:100 1 100 ns/op 2 GCs/op
+BenchmarkX/gogc:100 1 110 ns/op 2 GCs/op
+BenchmarkX/gogc:100 1 120 ns/op 2 GCs/op
+BenchmarkY 1 50 ns/op 5 MB/s
+BenchmarkY 1 50 ns/op 5 MB/s
+`)
+	new := mustParse(t, `commit: b
+BenchmarkX/gogc:100 1 200 ns/op 1 GCs/op
+BenchmarkX/gogc:100 1 210 ns/op 1 GCs/op
+BenchmarkX/gogc:100 1 220 ns/op 1 GCs/op
+BenchmarkZ 1 10 ns/op
+`)
+	cs := Compare(old, new)
+
+	// The block configuration is not part of the key, so the
+	// commits are compared. ns/op and MB/s sort first.
+	type group struct{ unit, key string }
+	var got []group
+	for _, c := range cs {
+		got = append(got, group{c.Unit, c.Key})
+	}
+	want := []group{
+		{"ns/op", "X/gogc:100/gomaxprocs:1"},
+		{"ns/op", "Y/gomaxprocs:1"},
+		{"ns/op", "Z/gomaxprocs:1"},
+		{"MB/s", "Y/gomaxprocs:1"},
+		{"GCs/op", "X/gogc:100/gomaxprocs:1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Compare grouped results as %v, want %v", got, want)
+	}
+
+	x := cs[0]
+	if x.Old.Mean != 110 || x.New.Mean != 210 || x.Old.StdDev != 10 {
+		t.Errorf("X ns/op: old %+v, new %+v", x.Old, x.New)
+	}
+	if math.Abs(x.Delta-(210.0/110-1)) > 1e-12 || x.P != 0.1 {
+		t.Errorf("X ns/op: delta %v p %v, want delta %v p 0.1", x.Delta, x.P, 210.0/110-1)
+	}
+	// ns/op got worse, but not significantly at 0.05 with 3 runs.
+	if ch := x.Change(0.2); ch != -1 {
+		t.Errorf("X ns/op: Change(0.2) = %d, want -1", ch)
+	}
+	if ch := x.Change(0.05); ch != 0 {
+		t.Errorf("X ns/op: Change(0.05) = %d, want 0", ch)
+	}
+	// GCs/op got better. The values are tied within each sample,
+	// so the tie-corrected variance is smaller and p is lower
+	// than for ns/op.
+	if gcs := cs[4]; math.Abs(gcs.P-0.046854) > 1e-6 || gcs.Change(0.05) != 1 {
+		t.Errorf("X GCs/op: p %v, Change(0.05) = %d; want p 0.046854, change 1", gcs.P, gcs.Change(0.05))
+	}
+
+	// Results missing from one side have no p-value or delta.
+	for _, c := range cs[1:4] {
+		if !math.IsNaN(c.P) || !math.IsNaN(c.Delta) || c.Change(1) != 0 {
+			t.Errorf("%s %s: p %v delta %v, want NaN", c.Key, c.Unit, c.P, c.Delta)
+		}
+	}
+	if y := cs[1]; len(y.Old.Values) != 2 || len(y.New.Values) != 0 || !math.IsNaN(y.New.Mean) {
+		t.Errorf("Y ns/op: old %+v, new %+v", y.Old, y.New)
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// csvColumn is a configuration or result column of a CSV file.
+type csvColumn struct {
+	kind string // "block", "config", or "result"
+	typ  string // Config value type, or "" for unparsed values
+	key  string // Config key or result unit
+}
+
+func (c csvColumn) String() string {
+	if c.typ == "" {
+		return c.kind + ":" + c.key
+	}
+	return c.kind + "/" + c.typ + ":" + c.key
+}
+
+func parseCSVColumn(s string) (csvColumn, error) {
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return csvColumn{}, fmt.Errorf("bad CSV column %q", s)
+	}
+	c := csvColumn{kind: s[:i], key: s[i+1:]}
+	if j := strings.Index(c.kind, "/"); j >= 0 {
+		c.kind, c.typ = c.kind[:j], c.kind[j+1:]
+	}
+	switch c.kind {
+	case "block", "config":
+		switch c.typ {
+		case "", typeInt, typeFloat, typeDuration, typeString:
+		default:
+			return csvColumn{}, fmt.Errorf("bad CSV column %q: unknown type %q", s, c.typ)
+		}
+	case "result":
+		if c.typ != "" {
+			return csvColumn{}, fmt.Errorf("bad CSV column %q: results are not typed", s)
+		}
+	default:
+		return csvColumn{}, fmt.Errorf("bad CSV column %q", s)
+	}
+	return c, nil
+}
+
+// escapeCSVConfig and unescapeCSVConfig distinguish empty
+// configuration values from absent ones, which are written as empty
+// cells.
+func escapeCSVConfig(raw string) string {
+	if raw == "" || raw[0] == '\\' {
+		return `\` + raw
+	}
+	return raw
+}
+
+func unescapeCSVConfig(cell string) string {
+	return strings.TrimPrefix(cell, `\`)
+}
+
+// WriteCSV writes bs to w as a CSV table with one row per benchmark.
+//
+// The first two columns are "name" and "iterations". These are
+// followed by a column for each configuration key and result unit.
+// Configuration columns are named "block:key" for configuration
+// block values and "config:key" for benchmark line values. If the
+// values of a key have been parsed by ParseValues, the column name
+// includes the value type, as in "config/int:gomaxprocs". Result
+// columns are named "result:unit".
+//
+// An empty cell indicates that a benchmark has no such configuration
+// key or result. Configuration values that are empty or start with a
+// backslash are written with an additional leading backslash.
+//
+// Config values must be of the types produced by DefaultValueParsers
+// and must be the result of parsing their RawValue with the parser
+// for that type. Unit metadata is not written.
+func WriteCSV(w io.Writer, bs []*Benchmark) error {
+	// Collect columns and their value types.
+	type colKey struct{ kind, key string }
+	types := make(map[colKey]string)
+	var resultCols []string
+	units := make(map[string]bool)
+	for _, b := range bs {
+		for k, c := range b.Config {
+			typ, val, err := encodeValue(c.Value)
+			if err != nil {
+				return fmt.Errorf("benchmark %s config %s: %v", b.Name, k, err)
+			}
+			if typ != "" {
+				v, err := decodeValue(typ, c.RawValue)
+				if _, rval, _ := encodeValue(v); err != nil || rval != val {
+					return fmt.Errorf("benchmark %s config %s: value %s is not the parsed form of %q", b.Name, k, val, c.RawValue)
+				}
+			}
+			ck := colKey{"config", k}
+			if c.InBlock {
+				ck.kind = "block"
+			}
+			if prev, ok := types[ck]; !ok {
+				types[ck] = typ
+			} else if prev != typ {
+				return fmt.Errorf("config %s has values of inconsistent types", k)
+			}
+		}
+		for unit := range b.Result {
+			if !units[unit] {
+				units[unit] = true
+				resultCols = append(resultCols, unit)
+			}
+		}
+	}
+	var cols []csvColumn
+	for ck, typ := range types {
+		cols = append(cols, csvColumn{ck.kind, typ, ck.key})
+	}
+	sort.Slice(cols, func(i, j int) bool {
+		if cols[i].kind != cols[j].kind {
+			return cols[i].kind < cols[j].kind
+		}
+		return cols[i].key < cols[j].key
+	})
+	sort.Sort(resultKeySorter(resultCols))
+	for _, unit := range resultCols {
+		cols = append(cols, csvColumn{kind: "result", key: unit})
+	}
+
+	cw := csv.NewWriter(w)
+	header := []string{"name", "iterations"}
+	for _, c := range cols {
+		header = append(header, c.String())
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, b := range bs {
+		row := []string{b.Name, strconv.Itoa(b.Iterations)}
+		for _, col := range cols {
+			cell := ""
+			if col.kind == "result" {
+				if v, ok := b.Result[col.key]; ok {
+					cell = strconv.FormatFloat(v, 'g', -1, 64)
+				}
+			} else if c, ok := b.Config[col.key]; ok && c.InBlock == (col.kind == "block") {
+				cell = escapeCSVConfig(c.RawValue)
+			}
+			row = append(row, cell)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV reads benchmarks written by WriteCSV from r.
+func ReadCSV(r io.Reader) ([]*Benchmark, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("missing CSV header")
+	} else if err != nil {
+		return nil, err
+	}
+	if len(header) < 2 || header[0] != "name" || header[1] != "iterations" {
+		return nil, fmt.Errorf("CSV header must start with name,iterations")
+	}
+	cols := make([]csvColumn, len(header)-2)
+	for i, h := range header[2:] {
+		if cols[i], err = parseCSVColumn(h); err != nil {
+			return nil, err
+		}
+	}
+
+	bs := []*Benchmark{}
+	for rowNum := 2; ; rowNum++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		b := &Benchmark{
+			Name:   row[0],
+			Config: make(map[string]*Config),
+			Result: make(map[string]float64),
+		}
+		if b.Iterations, err = strconv.Atoi(row[1]); err != nil {
+			return nil, fmt.Errorf("row %d: bad iterations %q", rowNum, row[1])
+		}
+		for i, cell := range row[2:] {
+			if cell == "" {
+				continue
+			}
+			col := cols[i]
+			if col.kind == "result" {
+				if b.Result[col.key], err = strconv.ParseFloat(cell, 64); err != nil {
+					return nil, fmt.Errorf("row %d: bad %s result %q", rowNum, col.key, cell)
+				}
+				continue
+			}
+			if b.Config[col.key] != nil {
+				return nil, fmt.Errorf("row %d: config %s is both a block and a benchmark value", rowNum, col.key)
+			}
+			c := &Config{RawValue: unescapeCSVConfig(cell), InBlock: col.kind == "block"}
+			if c.Value, err = decodeValue(col.typ, c.RawValue); err != nil {
+				return nil, fmt.Errorf("row %d: config %s: %v", rowNum, col.key, err)
+			}
+			b.Config[col.key] = c
+		}
+		bs = append(bs, b)
+	}
+	return bs, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const encodeTestInput = `commit: 123456
+date: Jan 1
+blank:
+escape: \x
+colon:colon: 42
+
+BenchmarkX	10	2 ns/op 3 MB/s
+BenchmarkX/heap:AST/retain:1GB/dur:10ms/ratio:0.5/gomaxprocs:4	1	2.5 ns/op 3 GCs/op 5000 95%ile-ns/markTerm
+
+commit: abcdef
+Unit ns/op better=higher scale=ms
+Unit widgets quantity=MB
+
+BenchmarkY/commit:xyz	2	4 ns/op
+`
+
+func testRoundTrip(t *testing.T, write func(io.Writer, []*Benchmark) error, read func(io.Reader) ([]*Benchmark, error), units bool) {
+	for _, parseValues := range []bool{false, true} {
+		bs, err := Parse(strings.NewReader(encodeTestInput))
+		if err != nil {
+			t.Fatal("unexpected Parse error", err)
+		}
+		if parseValues {
+			ParseValues(bs, nil)
+		}
+		if !units {
+			for _, b := range bs {
+				b.Units = nil
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := write(&buf, bs); err != nil {
+			t.Fatal("unexpected write error", err)
+		}
+		encoded := buf.String()
+		got, err := read(&buf)
+		if err != nil {
+			t.Fatalf("unexpected read error %v in:\n%s", err, encoded)
+		}
+		if !reflect.DeepEqual(got, bs) {
+			t.Errorf("round trip mismatch; encoded:\n%s", encoded)
+			for i := range bs {
+				t.Logf("want %#v", bs[i])
+				if i < len(got) {
+					t.Logf("got  %#v", got[i])
+				}
+			}
+		}
+
+		// Printing the decoded benchmarks should produce the
+		// same file as printing the originals.
+		var want, gotText bytes.Buffer
+		if err := Fprint(&want, bs); err != nil {
+			t.Fatal(err)
+		}
+		if err := Fprint(&gotText, got); err != nil {
+			t.Fatal(err)
+		}
+		if want.String() != gotText.String() {
+			t.Errorf("Fprint mismatch; want:\n%s\ngot:\n%s", want.String(), gotText.String())
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	testRoundTrip(t, WriteJSON, ReadJSON, true)
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	// CSV doesn't record unit metadata.
+	testRoundTrip(t, WriteCSV, ReadCSV, false)
+}
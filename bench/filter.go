@@ -0,0 +1,261 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Query selects benchmarks by name and configuration.
+//
+// A query is a space-separated list of terms, all of which must match
+// a benchmark for the query to match. Each term has the form
+// "key op value", where op is one of
+//
+//	:  =  !=  <  <=  >  >=
+//
+// ":" and "=" are synonyms. The key "name" matches the benchmark name
+// against value as a glob pattern, as in path.Match, and supports only
+// equality operators. Any other key compares the configuration value
+// of that key. For example,
+//
+//	name:LargeHeap retain>=1GB heap:AST gomaxprocs:4
+//
+// Configuration values are compared according to their type: if
+// ParseValues has set Config.Value, that type is used; otherwise, the
+// raw value is parsed using DefaultValueParsers. Integers and floats
+// compare numerically and durations compare as time.Durations. String
+// values that are both byte sizes such as "512MB" or "1GiB" compare
+// as numbers of bytes; other strings compare as glob patterns for
+// equality and lexically otherwise.
+//
+// A benchmark without a given configuration key matches only "!="
+// terms for that key.
+type Query struct {
+	terms []queryTerm
+}
+
+type queryTerm struct {
+	key, op, value string
+}
+
+// queryOps lists query operators, longest first so that prefixes of
+// longer operators don't match first.
+var queryOps = []string{"!=", "<=", ">=", ":", "=", "<", ">"}
+
+// ParseQuery parses the query expression expr. An empty expression
+// matches all benchmarks.
+func ParseQuery(expr string) (*Query, error) {
+	q := new(Query)
+	for _, term := range strings.Fields(expr) {
+		i := strings.IndexAny(term, ":=!<>")
+		if i <= 0 {
+			return nil, fmt.Errorf("bad query term %q: expected key op value", term)
+		}
+		key, rest := term[:i], term[i:]
+		op := ""
+		for _, o := range queryOps {
+			if strings.HasPrefix(rest, o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return nil, fmt.Errorf("bad query term %q: unknown operator", term)
+		}
+		if op == "=" {
+			op = ":"
+		}
+		value := rest[len(op):]
+		if key == "name" {
+			if op != ":" && op != "!=" {
+				return nil, fmt.Errorf("bad query term %q: name supports only : and !=", term)
+			}
+			if _, err := path.Match(value, ""); err != nil {
+				return nil, fmt.Errorf("bad query term %q: %v", term, err)
+			}
+		}
+		q.terms = append(q.terms, queryTerm{key, op, value})
+	}
+	return q, nil
+}
+
+// Match returns whether b satisfies all of the terms of q.
+func (q *Query) Match(b *Benchmark) bool {
+	for _, t := range q.terms {
+		if !t.match(b) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *queryTerm) match(b *Benchmark) bool {
+	if t.key == "name" {
+		ok, _ := path.Match(t.value, b.Name)
+		return ok == (t.op == ":")
+	}
+
+	c, ok := b.Config[t.key]
+	if !ok {
+		return t.op == "!="
+	}
+	cmp, ok := compareConfig(c, t.value)
+	if !ok {
+		// The values are incomparable, so they're certainly
+		// not equal and have no order.
+		return t.op == "!="
+	}
+	switch t.op {
+	case ":":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	panic("bad query operator " + t.op)
+}
+
+// compareConfig compares the value of c to the query value s,
+// interpreting s according to the type of c's value. It returns -1,
+// 0, or 1 if c is less than, equal to, or greater than s, or false if
+// s can't be interpreted as c's type.
+func compareConfig(c *Config, s string) (int, bool) {
+	v := c.Value
+	if v == nil {
+		v = c.RawValue
+		for _, vp := range DefaultValueParsers {
+			if pv, err := vp(c.RawValue); err == nil {
+				v = pv
+				break
+			}
+		}
+	}
+
+	switch v := v.(type) {
+	case int:
+		// Allow float query values for int keys.
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, false
+		}
+		return compareFloat(float64(v), x), true
+
+	case float64:
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, false
+		}
+		return compareFloat(v, x), true
+
+	case time.Duration:
+		x, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, false
+		}
+		return compareFloat(float64(v), float64(x)), true
+
+	case string:
+		vb, err1 := parseBytes(v)
+		xb, err2 := parseBytes(s)
+		if err1 == nil && err2 == nil {
+			return compareFloat(vb, xb), true
+		}
+		if ok, _ := path.Match(s, v); ok {
+			return 0, true
+		}
+		return strings.Compare(v, s), true
+	}
+	// Values of other types can only be compared by their
+	// raw value.
+	if c.RawValue == s {
+		return 0, true
+	}
+	return 0, false
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+var siPrefixes = []string{"", "k", "M", "G", "T", "P", "E", "Z", "Y"}
+
+// parseBytes parses a byte size with an optional SI or binary prefix,
+// such as "64kB" or "1GiB", in the format written by gcbench.Bytes.
+func parseBytes(s string) (float64, error) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !('0' <= r && r <= '9' || r == '.' || r == 'e' || r == '+' || r == '-')
+	})
+	if i <= 0 {
+		return 0, fmt.Errorf("bad byte size %q", s)
+	}
+	num, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad byte size %q", s)
+	}
+	unit := s[i:]
+	si, bin := num, num
+	for _, p := range siPrefixes {
+		if unit == p+"B" {
+			return si, nil
+		}
+		if unit == p+"iB" {
+			return bin, nil
+		}
+		si *= 1000
+		bin *= 1024
+	}
+	return 0, fmt.Errorf("bad byte size %q", s)
+}
+
+// Filter returns the benchmarks in bs that match q.
+func Filter(bs []*Benchmark, q *Query) []*Benchmark {
+	var out []*Benchmark
+	for _, b := range bs {
+		if q.Match(b) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// Project returns copies of the benchmarks in bs with only the
+// results in the given units. Benchmarks with none of these units are
+// omitted. The returned Benchmarks share Config with bs.
+func Project(bs []*Benchmark, units []string) []*Benchmark {
+	var out []*Benchmark
+	for _, b := range bs {
+		result := make(map[string]float64)
+		for _, unit := range units {
+			if v, ok := b.Result[unit]; ok {
+				result[unit] = v
+			}
+		}
+		if len(result) == 0 {
+			continue
+		}
+		nb := *b
+		nb.Result = result
+		out = append(out, &nb)
+	}
+	return out
+}
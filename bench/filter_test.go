@@ -0,0 +1,171 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	for _, test := range []struct {
+		expr  string
+		terms []queryTerm
+	}{
+		{"", nil},
+		{"name:X", []queryTerm{{"name", ":", "X"}}},
+		{"name=X*", []queryTerm{{"name", ":", "X*"}}},
+		{"name!=X", []queryTerm{{"name", "!=", "X"}}},
+		{"a<1 b<=2 c>3 d>=4", []queryTerm{{"a", "<", "1"}, {"b", "<=", "2"}, {"c", ">", "3"}, {"d", ">=", "4"}}},
+		{"  retain>=1GB   heap:AST ", []queryTerm{{"retain", ">=", "1GB"}, {"heap", ":", "AST"}}},
+		{"a:", []queryTerm{{"a", ":", ""}}},
+	} {
+		q, err := ParseQuery(test.expr)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", test.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.terms, test.terms) {
+			t.Errorf("ParseQuery(%q) = %v, want %v", test.expr, q.terms, test.terms)
+		}
+	}
+
+	for _, expr := range []string{
+		"name",
+		":X",
+		"a!1",
+		"name<X",
+		"name>=X",
+		"name:[",
+	} {
+		if _, err := ParseQuery(expr); err == nil {
+			t.Errorf("ParseQuery(%q): want error", expr)
+		}
+	}
+}
+
+func TestCompareConfig(t *testing.T) {
+	for _, test := range []struct {
+		c    *Config
+		s    string
+		cmp  int
+		okay bool
+	}{
+		// Raw values are parsed with DefaultValueParsers.
+		{&Config{RawValue: "4"}, "4", 0, true},
+		{&Config{RawValue: "4"}, "10", -1, true},
+		{&Config{RawValue: "4"}, "3.5", 1, true},
+		{&Config{RawValue: "4"}, "x", 0, false},
+		{&Config{RawValue: "0.5"}, "0.25", 1, true},
+		{&Config{RawValue: "0.5"}, "1s", 0, false},
+		{&Config{RawValue: "100ms"}, "1s", -1, true},
+		{&Config{RawValue: "100ms"}, "100000us", 0, true},
+		{&Config{RawValue: "100ms"}, "100", 0, false},
+
+		// Parsed values take precedence over the raw value.
+		{&Config{RawValue: "10", Value: 10 * time.Second}, "1m", -1, true},
+		{&Config{RawValue: "10", Value: "10"}, "9", -1, true}, // Lexically
+
+		// Byte sizes compare numerically.
+		{&Config{RawValue: "1GB"}, "512MB", 1, true},
+		{&Config{RawValue: "1GiB"}, "1024MiB", 0, true},
+		{&Config{RawValue: "1GB"}, "1GiB", -1, true},
+		{&Config{RawValue: "64kB"}, "64000B", 0, true},
+
+		// Other strings compare as globs for equality and
+		// lexically otherwise.
+		{&Config{RawValue: "AST"}, "AST", 0, true},
+		{&Config{RawValue: "AST"}, "A*", 0, true},
+		{&Config{RawValue: "AST"}, "B*", -1, true},
+		{&Config{RawValue: "AST"}, "AA", 1, true},
+		{&Config{RawValue: "1GB"}, "G*", -1, true},
+
+		// Other types compare only by raw value.
+		{&Config{RawValue: "x", Value: []int{1}}, "x", 0, true},
+		{&Config{RawValue: "x", Value: []int{1}}, "y", 0, false},
+	} {
+		cmp, ok := compareConfig(test.c, test.s)
+		if cmp != test.cmp || ok != test.okay {
+			t.Errorf("compareConfig(%q (%T), %q) = %d, %v; want %d, %v", test.c.RawValue, test.c.Value, test.s, cmp, ok, test.cmp, test.okay)
+		}
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		want float64
+	}{
+		{"0B", 0},
+		{"512B", 512},
+		{"64kB", 64e3},
+		{"1.5MB", 1.5e6},
+		{"1GB", 1e9},
+		// Binary prefixes are spelled as gcbench.Bytes parses
+		// them.
+		{"1kiB", 1024},
+		{"2MiB", 2 << 20},
+		{"1GiB", 1 << 30},
+		{"1e3B", 1000},
+	} {
+		got, err := parseBytes(test.s)
+		if err != nil || got != test.want {
+			t.Errorf("parseBytes(%q) = %v, %v; want %v", test.s, got, err, test.want)
+		}
+	}
+	for _, s := range []string{"", "B", "MB", "1", "1 MB", "1mb", "1XB", "1..2B"} {
+		if _, err := parseBytes(s); err == nil {
+			t.Errorf("parseBytes(%q): want error", s)
+		}
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	bs := mustParse(t, `heap: AST
+BenchmarkLargeHeap/retain:1GB/gcpercent:100 1 1 ns/op
+BenchmarkLargeHeap/retain:512MB/gcpercent:200 1 1 ns/op
+BenchmarkLargeHeap/retain:64MB 1 1 ns/op
+BenchmarkChurn/rate:10ms/gomaxprocs:4 1 1 ns/op
+`)
+	for _, test := range []struct {
+		expr string
+		want []int
+	}{
+		{"", []int{0, 1, 2, 3}},
+		{"name:LargeHeap", []int{0, 1, 2}},
+		{"name:*Heap", []int{0, 1, 2}},
+		{"name!=LargeHeap", []int{3}},
+		{"retain>=512MB", []int{0, 1}},
+		{"retain<1GiB", []int{0, 1, 2}},
+		{"retain:64MB heap:AST", []int{2}},
+		{"heap:A*", []int{0, 1, 2, 3}},
+		{"gomaxprocs:4", []int{3}},
+		{"gomaxprocs>1.5", []int{3}},
+		{"rate<1s", []int{3}},
+		// Missing keys match only !=.
+		{"gcpercent:100", []int{0}},
+		{"gcpercent!=100", []int{1, 2, 3}},
+		{"gcpercent>0", []int{0, 1}},
+		// Incomparable values are unequal and unordered.
+		{"gomaxprocs!=x", []int{0, 1, 2, 3}},
+		{"gomaxprocs<x", nil},
+	} {
+		q, err := ParseQuery(test.expr)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", test.expr, err)
+			continue
+		}
+		var got []int
+		for i, b := range bs {
+			if q.Match(b) {
+				got = append(got, i)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("query %q matched %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
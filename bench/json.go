@@ -0,0 +1,137 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// jsonBenchmark is the JSON encoding of a Benchmark.
+type jsonBenchmark struct {
+	Name       string
+	Iterations int
+	Config     map[string]jsonConfig
+	Result     map[string]float64
+	Units      map[string]Unit `json:",omitempty"`
+}
+
+// jsonConfig is the JSON encoding of a Config. Type and Value encode
+// the parsed Config.Value, if any. Value is the canonical string form
+// of the parsed value, which may differ from RawValue.
+type jsonConfig struct {
+	RawValue string
+	InBlock  bool   `json:",omitempty"`
+	Type     string `json:",omitempty"`
+	Value    string `json:",omitempty"`
+}
+
+// Config value type names used by the JSON and CSV encodings.
+const (
+	typeInt      = "int"
+	typeFloat    = "float"
+	typeDuration = "duration"
+	typeString   = "string"
+)
+
+// encodeValue returns the type name and canonical string form of a
+// parsed configuration value. v must be nil or one of the types
+// produced by DefaultValueParsers.
+func encodeValue(v interface{}) (typ, val string, err error) {
+	switch v := v.(type) {
+	case nil:
+		return "", "", nil
+	case int:
+		return typeInt, strconv.Itoa(v), nil
+	case float64:
+		return typeFloat, strconv.FormatFloat(v, 'g', -1, 64), nil
+	case time.Duration:
+		return typeDuration, v.String(), nil
+	case string:
+		return typeString, v, nil
+	}
+	return "", "", fmt.Errorf("unsupported configuration value type %T", v)
+}
+
+// decodeValue is the inverse of encodeValue.
+func decodeValue(typ, val string) (interface{}, error) {
+	switch typ {
+	case "":
+		return nil, nil
+	case typeInt:
+		return strconv.Atoi(val)
+	case typeFloat:
+		return strconv.ParseFloat(val, 64)
+	case typeDuration:
+		return time.ParseDuration(val)
+	case typeString:
+		return val, nil
+	}
+	return nil, fmt.Errorf("unknown configuration value type %q", typ)
+}
+
+// WriteJSON writes bs to w as a JSON array of benchmarks. Each
+// benchmark is an object with Name, Iterations, Config, Result, and,
+// if it has unit metadata, Units fields. Config maps each key to an
+// object with the RawValue and InBlock of the Config and, if the
+// Config has a parsed Value, its Type ("int", "float", "duration", or
+// "string") and canonical string Value.
+//
+// Config values must be of the types produced by DefaultValueParsers
+// and results must be finite.
+func WriteJSON(w io.Writer, bs []*Benchmark) error {
+	jbs := make([]jsonBenchmark, len(bs))
+	for i, b := range bs {
+		jb := jsonBenchmark{
+			Name:       b.Name,
+			Iterations: b.Iterations,
+			Config:     make(map[string]jsonConfig),
+			Result:     b.Result,
+			Units:      b.Units,
+		}
+		for k, c := range b.Config {
+			typ, val, err := encodeValue(c.Value)
+			if err != nil {
+				return fmt.Errorf("benchmark %s config %s: %v", b.Name, k, err)
+			}
+			jb.Config[k] = jsonConfig{c.RawValue, c.InBlock, typ, val}
+		}
+		jbs[i] = jb
+	}
+	return json.NewEncoder(w).Encode(jbs)
+}
+
+// ReadJSON reads benchmarks written by WriteJSON from r.
+func ReadJSON(r io.Reader) ([]*Benchmark, error) {
+	var jbs []jsonBenchmark
+	if err := json.NewDecoder(r).Decode(&jbs); err != nil {
+		return nil, err
+	}
+	bs := make([]*Benchmark, len(jbs))
+	for i, jb := range jbs {
+		b := &Benchmark{
+			Name:       jb.Name,
+			Iterations: jb.Iterations,
+			Config:     make(map[string]*Config),
+			Result:     jb.Result,
+			Units:      jb.Units,
+		}
+		if b.Result == nil {
+			b.Result = make(map[string]float64)
+		}
+		for k, jc := range jb.Config {
+			v, err := decodeValue(jc.Type, jc.Value)
+			if err != nil {
+				return nil, fmt.Errorf("benchmark %s config %s: %v", jb.Name, k, err)
+			}
+			b.Config[k] = &Config{Value: v, RawValue: jc.RawValue, InBlock: jc.InBlock}
+		}
+		bs[i] = b
+	}
+	return bs, nil
+}
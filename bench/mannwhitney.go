@@ -0,0 +1,136 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"math"
+	"sort"
+)
+
+// maxExactU is the largest n1*n2 for which mannWhitneyUTest computes
+// the exact distribution of U rather than using the normal
+// approximation.
+const maxExactU = 2500
+
+// mannWhitneyUTest performs a two-sided Mann-Whitney U test of
+// whether samples x1 and x2 come from the same distribution. It
+// returns the U statistic of x1 and the p-value. If either sample is
+// empty, p is NaN.
+//
+// If there are no ties and the samples are small, p is computed from
+// the exact distribution of U. Otherwise, it uses the normal
+// approximation with a tie correction.
+func mannWhitneyUTest(x1, x2 []float64) (U, p float64) {
+	n1, n2 := len(x1), len(x2)
+	if n1 == 0 || n2 == 0 {
+		return math.NaN(), math.NaN()
+	}
+
+	// Rank the combined samples, giving ties their average rank.
+	type obs struct {
+		v     float64
+		first bool
+	}
+	all := make([]obs, 0, n1+n2)
+	for _, v := range x1 {
+		all = append(all, obs{v, true})
+	}
+	for _, v := range x2 {
+		all = append(all, obs{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+	var r1, tieSum float64
+	ties := false
+	for i := 0; i < len(all); {
+		j := i + 1
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // Average of ranks i+1 through j
+		for k := i; k < j; k++ {
+			if all[k].first {
+				r1 += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties = true
+			tieSum += t*t*t - t
+		}
+		i = j
+	}
+	U = r1 - float64(n1*(n1+1))/2
+
+	if !ties && n1*n2 <= maxExactU {
+		return U, exactUPValue(n1, n2, U)
+	}
+
+	// Normal approximation.
+	n := float64(n1 + n2)
+	mu := float64(n1*n2) / 2
+	sigma2 := float64(n1*n2) / 12 * ((n + 1) - tieSum/(n*(n-1)))
+	if sigma2 <= 0 {
+		// All values are equal.
+		return U, 1
+	}
+	// Apply a continuity correction.
+	z := math.Abs(U-mu) - 0.5
+	if z < 0 {
+		z = 0
+	}
+	z /= math.Sqrt(sigma2)
+	p = math.Erfc(z / math.Sqrt2)
+	if p > 1 {
+		p = 1
+	}
+	return U, p
+}
+
+// exactUPValue returns the two-sided p-value of U for samples of
+// size n1 and n2 with no ties.
+func exactUPValue(n1, n2 int, U float64) float64 {
+	// counts[j][u] is the number of arrangements of i values from
+	// the first sample and j from the second with U statistic u,
+	// for the current i. The recurrence adds the largest value,
+	// which either comes from the first sample (and is greater
+	// than all j values of the second) or from the second.
+	counts := make([][]float64, n2+1)
+	for j := range counts {
+		counts[j] = []float64{1}
+	}
+	for i := 1; i <= n1; i++ {
+		next := make([][]float64, n2+1)
+		next[0] = []float64{1}
+		for j := 1; j <= n2; j++ {
+			c := make([]float64, i*j+1)
+			// Largest from the first sample: adds j to U.
+			for u, n := range counts[j] {
+				c[u+j] += n
+			}
+			// Largest from the second sample.
+			for u, n := range next[j-1] {
+				c[u] += n
+			}
+			next[j] = c
+		}
+		counts = next
+	}
+
+	dist := counts[n2]
+	var total, le, ge float64
+	for u, n := range dist {
+		total += n
+		if float64(u) <= U {
+			le += n
+		}
+		if float64(u) >= U {
+			ge += n
+		}
+	}
+	p := 2 * math.Min(le, ge) / total
+	if p > 1 {
+		p = 1
+	}
+	return p
+}
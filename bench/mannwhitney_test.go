@@ -0,0 +1,71 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"math"
+	"testing"
+)
+
+func seq(n int, start float64) []float64 {
+	x := make([]float64, n)
+	for i := range x {
+		x[i] = start + float64(i)
+	}
+	return x
+}
+
+func TestMannWhitneyUTest(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		x1, x2 []float64
+		U, p   float64
+	}{
+		// Exact distribution. Of the 20 arrangements of two
+		// samples of 3, one has U=0 and one has U=9.
+		{"exact", []float64{1, 2, 3}, []float64{4, 5, 6}, 0, 0.1},
+		{"exact reversed", []float64{4, 5, 6}, []float64{1, 2, 3}, 9, 0.1},
+		{"exact interleaved", []float64{1, 3, 5}, []float64{2, 4, 6}, 3, 0.7},
+
+		// Ties use the normal approximation with the tie
+		// correction. The ranks of x1 are 1, 3, 3, and 5.5.
+		{"ties", []float64{1, 2, 2, 3}, []float64{2, 3, 4, 5}, 2.5, 0.13665824773814753},
+		{"all tied", []float64{1, 1, 1}, []float64{1, 1, 1}, 4.5, 1},
+
+		// n1*n2 > maxExactU uses the normal approximation even
+		// without ties.
+		{"normal", seq(51, 0), seq(51, 10.5), 820, 0.001315853666791126},
+
+		{"empty", nil, []float64{1}, math.NaN(), math.NaN()},
+	} {
+		U, p := mannWhitneyUTest(test.x1, test.x2)
+		if !same(U, test.U) || !same(p, test.p) && !(math.Abs(p-test.p) < 1e-9) {
+			t.Errorf("%s: got U=%v p=%v, want U=%v p=%v", test.name, U, p, test.U, test.p)
+		}
+	}
+}
+
+func TestMannWhitneyUApprox(t *testing.T) {
+	// Just below maxExactU, the normal approximation should agree
+	// with the exact p-value to within 20%.
+	x1, x2 := seq(50, 0), seq(50, 10.5)
+	if len(x1)*len(x2) > maxExactU {
+		t.Fatalf("samples too large for the exact test")
+	}
+	U, exact := mannWhitneyUTest(x1, x2)
+	if U != 780 {
+		t.Fatalf("U = %v, want 780", U)
+	}
+	// The approximation computed by hand.
+	const approx = 0.001209423107033346
+	if math.Abs(exact-approx)/exact > 0.2 {
+		t.Errorf("exact p=%v, normal approximation p=%v", exact, approx)
+	}
+}
+
+// same returns whether x and y are equal or both NaN.
+func same(x, y float64) bool {
+	return x == y || math.IsNaN(x) && math.IsNaN(y)
+}
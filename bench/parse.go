@@ -9,7 +9,7 @@
 package bench
 
 import (
-	"bufio"
+	"fmt"
 	"io"
 	"regexp"
 	"strconv"
@@ -39,6 +39,11 @@ type Benchmark struct {
 	// Result is the set of (unit, value) metrics for this
 	// benchmark run.
 	Result map[string]float64
+
+	// Units describes result units as given by the unit metadata
+	// lines preceding this benchmark, if any. Use Unit to get
+	// the full description of a unit.
+	Units map[string]Unit
 }
 
 // Config represents a single key/value configuration pair.
@@ -66,37 +71,18 @@ var configRe = regexp.MustCompile(`^(\p{Ll}[^\p{Lu}\s\x85\xa0\x{1680}\x{2000}-\x
 //
 // In the returned Benchmarks, RawValue is set, but Value is always
 // nil. Use ParseValues to convert raw values to structured types.
+//
+// Parse ignores malformed benchmark lines. Use a Reader to report
+// them or to process large files incrementally.
 func Parse(r io.Reader) ([]*Benchmark, error) {
 	benchmarks := []*Benchmark{}
-	config := make(map[string]*Config)
-
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		if line == "testing: warning: no tests to run" {
-			continue
-		}
-
-		// Configuration lines.
-		m := configRe.FindStringSubmatch(line)
-		if m != nil {
-			config[m[1]] = &Config{RawValue: m[2], InBlock: true}
-			continue
-		}
-
-		// Benchmark lines.
-		if strings.HasPrefix(line, "Benchmark") {
-			b := parseBenchmark(line, config)
-			if b != nil {
-				benchmarks = append(benchmarks, b)
-			}
-		}
+	br := NewReader(r)
+	for br.Next() {
+		benchmarks = append(benchmarks, br.Benchmark())
 	}
-	if err := scanner.Err(); err != nil {
+	if err := br.Err(); err != nil {
 		return nil, err
 	}
-
 	return benchmarks, nil
 }
 
@@ -107,7 +93,7 @@ var fastSpace = [128]bool{
 func nextField(s string) (field, rest string) {
 	// Find beginning of field.
 	for i, c := range s {
-		if (i < 128 && !fastSpace[c]) || (i >= 128 && !unicode.IsSpace(c)) {
+		if (c < 128 && !fastSpace[c]) || (c >= 128 && !unicode.IsSpace(c)) {
 			s = s[i:]
 			goto found
 		}
@@ -117,19 +103,22 @@ func nextField(s string) (field, rest string) {
 found:
 	// Find end of field.
 	for i, c := range s {
-		if (i < 128 && fastSpace[c]) || (i >= 128 && unicode.IsSpace(c)) {
+		if (c < 128 && fastSpace[c]) || (c >= 128 && unicode.IsSpace(c)) {
 			return s[:i], s[i:]
 		}
 	}
 	return s, ""
 }
 
-func parseBenchmark(line string, gconfig map[string]*Config) *Benchmark {
+// parseBenchmark parses a benchmark line. If line is malformed, it
+// returns an error describing why. Otherwise, it returns the
+// Benchmark and a description of each field it ignored, if any.
+func parseBenchmark(line string, gconfig map[string]*Config) (*Benchmark, []string, error) {
 	name, line := nextField(line)
 	if name != "Benchmark" {
 		next, _ := utf8.DecodeRuneInString(name[len("Benchmark"):])
 		if !unicode.IsUpper(next) {
-			return nil
+			return nil, nil, fmt.Errorf("benchmark name %q must start with an upper case letter after \"Benchmark\"", name)
 		}
 	}
 
@@ -172,36 +161,38 @@ func parseBenchmark(line string, gconfig map[string]*Config) *Benchmark {
 	// Parse iterations.
 	iters, line := nextField(line)
 	if iters == "" {
-		return nil
+		return nil, nil, fmt.Errorf("missing iteration count")
 	}
 	n, err := strconv.Atoi(iters)
 	if err != nil || n <= 0 {
-		return nil
+		return nil, nil, fmt.Errorf("iteration count %q is not a positive integer", iters)
 	}
 	b.Iterations = n
 
 	// Parse results.
+	var skipped []string
 	for i := 0; ; i++ {
 		var k, v string
 		v, line = nextField(line)
 		if v == "" {
 			if i == 0 {
-				return nil
+				return nil, nil, fmt.Errorf("missing results")
 			}
 			break
 		}
 		val, err := strconv.ParseFloat(v, 64)
 		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("ignoring non-numeric value %q", v))
 			continue
 		}
 		k, line = nextField(line)
 		if k == "" {
-			return nil
+			return nil, nil, fmt.Errorf("missing unit for value %s", v)
 		}
 		b.Result[k] = val
 	}
 
-	return b
+	return b, skipped, nil
 }
 
 // ValueParser is a function that parses a string value into a
@@ -19,7 +19,9 @@ func TestParse(t *testing.T) {
 		{`
 BenchmarkX	1	2 ns/op 3 MB/s`,
 			[]*Benchmark{
-				{"X", 1, map[string]*Config{}, map[string]float64{"ns/op": 2, "MB/s": 3}},
+				{"X", 1, map[string]*Config{
+					"gomaxprocs": &Config{RawValue: "1"},
+				}, map[string]float64{"ns/op": 2, "MB/s": 3}, nil},
 			},
 		},
 
@@ -27,7 +29,9 @@ BenchmarkX	1	2 ns/op 3 MB/s`,
 		{`
 Benchmark	1	2 ns/op`,
 			[]*Benchmark{
-				{"", 1, map[string]*Config{}, map[string]float64{"ns/op": 2}},
+				{"", 1, map[string]*Config{
+					"gomaxprocs": &Config{RawValue: "1"},
+				}, map[string]float64{"ns/op": 2}, nil},
 			},
 		},
 
@@ -52,8 +56,8 @@ BenchmarkX	1	2`,
 BenchmarkX-4	1	2 ns/op`,
 			[]*Benchmark{
 				{"X", 1, map[string]*Config{
-					"gomaxprocs": &Config{"gomaxprocs", "4", "4", false},
-				}, map[string]float64{"ns/op": 2}},
+					"gomaxprocs": &Config{RawValue: "4"},
+				}, map[string]float64{"ns/op": 2}, nil},
 			},
 		},
 
@@ -63,12 +67,14 @@ BenchmarkX/a:20/b:abc	1	2 ns/op
 BenchmarkY/c:123	2	4 ns/op`,
 			[]*Benchmark{
 				{"X", 1, map[string]*Config{
-					"a": &Config{"a", "20", "20", false},
-					"b": &Config{"b", "abc", "abc", false},
-				}, map[string]float64{"ns/op": 2}},
+					"a":          &Config{RawValue: "20"},
+					"b":          &Config{RawValue: "abc"},
+					"gomaxprocs": &Config{RawValue: "1"},
+				}, map[string]float64{"ns/op": 2}, nil},
 				{"Y", 2, map[string]*Config{
-					"c": &Config{"c", "123", "123", false},
-				}, map[string]float64{"ns/op": 4}},
+					"c":          &Config{RawValue: "123"},
+					"gomaxprocs": &Config{RawValue: "1"},
+				}, map[string]float64{"ns/op": 4}, nil},
 			},
 		},
 
@@ -85,11 +91,12 @@ Not-config: x
 BenchmarkX	1	2 ns/op`,
 			[]*Benchmark{
 				{"X", 1, map[string]*Config{
-					"commit":      &Config{"commit", "123456", "123456", true},
-					"date":        &Config{"date", "Jan 1", "Jan 1", true},
-					"colon:colon": &Config{"colon:colon", "42", "42", true},
-					"blank":       &Config{"blank", "", "", true},
-				}, map[string]float64{"ns/op": 2}},
+					"commit":      &Config{RawValue: "123456", InBlock: true},
+					"date":        &Config{RawValue: "Jan 1", InBlock: true},
+					"colon:colon": &Config{RawValue: "42", InBlock: true},
+					"blank":       &Config{RawValue: "", InBlock: true},
+					"gomaxprocs":  &Config{RawValue: "1"},
+				}, map[string]float64{"ns/op": 2}, nil},
 			},
 		},
 
@@ -100,9 +107,10 @@ date: Jan 1
 BenchmarkX/commit:abcdef	1	2 ns/op`,
 			[]*Benchmark{
 				{"X", 1, map[string]*Config{
-					"commit": &Config{"commit", "abcdef", "abcdef", false},
-					"date":   &Config{"date", "Jan 1", "Jan 1", true},
-				}, map[string]float64{"ns/op": 2}},
+					"commit":     &Config{RawValue: "abcdef"},
+					"date":       &Config{RawValue: "Jan 1", InBlock: true},
+					"gomaxprocs": &Config{RawValue: "1"},
+				}, map[string]float64{"ns/op": 2}, nil},
 			},
 		},
 
@@ -114,9 +122,10 @@ date: Jan 1
 BenchmarkX	1	2 ns/op`,
 			[]*Benchmark{
 				{"X", 1, map[string]*Config{
-					"commit": &Config{"commit", "abcdef", "abcdef", true},
-					"date":   &Config{"date", "Jan 1", "Jan 1", true},
-				}, map[string]float64{"ns/op": 2}},
+					"commit":     &Config{RawValue: "abcdef", InBlock: true},
+					"date":       &Config{RawValue: "Jan 1", InBlock: true},
+					"gomaxprocs": &Config{RawValue: "1"},
+				}, map[string]float64{"ns/op": 2}, nil},
 			},
 		},
 	} {
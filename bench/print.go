@@ -7,9 +7,13 @@ package bench
 import (
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Print pretty-prints bs to stdout in standard benchmark format.
@@ -18,12 +22,27 @@ func Print(bs []*Benchmark) error {
 }
 
 // Fprint pretty-prints bs to w in standard benchmark format.
+//
+// Fprint returns an error without writing anything if bs can't be
+// represented in the benchmark format such that Parse would read
+// back the same Benchmarks. This includes names, configuration keys
+// and values, and result units that contain whitespace or separator
+// characters, and block configuration keys that are present in one
+// benchmark but missing from a later one. Result values are printed
+// with at least three significant figures and as many more as
+// necessary to represent them exactly. Each benchmark's Units are
+// written as unit metadata lines when they change; like block
+// configuration, a unit described for one benchmark must also be
+// described, possibly differently, in all later ones. Parse adds a
+// "gomaxprocs" configuration value of "1" to benchmarks that have
+// none, so Benchmarks without one will not round-trip exactly.
 func Fprint(w io.Writer, bs []*Benchmark) error {
 	type kv struct {
 		k, v string
 	}
 	type block struct {
 		config []kv
+		units  []Unit
 		bs     []*Benchmark
 	}
 
@@ -41,7 +60,17 @@ func Fprint(w io.Writer, bs []*Benchmark) error {
 	// Split bs into configuration blocks.
 	blocks := []block{}
 	lastConfig := map[string]string{}
+	lastUnits := map[string]Unit{}
 	for _, b := range bs {
+		if err := checkBenchmark(b); err != nil {
+			return err
+		}
+		for k := range lastConfig {
+			if b.Config[k] == nil {
+				return fmt.Errorf("benchmark %s: missing block configuration key %q set by an earlier benchmark", b.Name, k)
+			}
+		}
+
 		// Find changed block configuration.
 		var changed []kv
 		for _, k := range configKeys(b, true) {
@@ -50,14 +79,36 @@ func Fprint(w io.Writer, bs []*Benchmark) error {
 			if ok && lc == config.RawValue {
 				continue
 			}
+			if err := checkBlockConfig(k, config.RawValue); err != nil {
+				return fmt.Errorf("benchmark %s: %v", b.Name, err)
+			}
 
 			changed = append(changed, kv{k, config.RawValue})
 			lastConfig[k] = config.RawValue
 		}
 
-		if len(blocks) == 0 || changed != nil {
+		// Find changed unit metadata.
+		var changedUnits []Unit
+		for name := range lastUnits {
+			if _, ok := b.Units[name]; !ok {
+				return fmt.Errorf("benchmark %s: missing metadata for unit %q described by an earlier benchmark", b.Name, name)
+			}
+		}
+		for name, u := range b.Units {
+			if lu, ok := lastUnits[name]; ok && lu == u {
+				continue
+			}
+			if pu, _, err := parseUnitLine(u.String()); u.Name != name || containsSpace(name) || err != nil || pu != u {
+				return fmt.Errorf("benchmark %s: unit metadata %q can't be represented", b.Name, u)
+			}
+			changedUnits = append(changedUnits, u)
+			lastUnits[name] = u
+		}
+		sort.Slice(changedUnits, func(i, j int) bool { return changedUnits[i].Name < changedUnits[j].Name })
+
+		if len(blocks) == 0 || changed != nil || changedUnits != nil {
 			// Start a new configuration block.
-			blocks = append(blocks, block{changed, nil})
+			blocks = append(blocks, block{changed, changedUnits, nil})
 		}
 
 		// Add benchmark to latest block.
@@ -74,19 +125,23 @@ func Fprint(w io.Writer, bs []*Benchmark) error {
 			}
 		}
 		for _, kv := range block.config {
-			// TODO: Syntax check.
 			if _, err := fmt.Fprintf(w, "%s: %s\n", kv.k, kv.v); err != nil {
 				return err
 			}
 		}
-		if len(block.config) > 0 {
+		for _, u := range block.units {
+			if _, err := fmt.Fprintf(w, "%s\n", u); err != nil {
+				return err
+			}
+		}
+		if len(block.config) > 0 || len(block.units) > 0 {
 			if _, err := fmt.Fprint(w, "\n"); err != nil {
 				return err
 			}
 		}
 
 		// Construct benchmark lines.
-		lines := make([][]string, len(block.bs))
+		lines := make([][]string, 0, len(block.bs))
 		for _, b := range block.bs {
 			// Construct benchmark name.
 			name := []string{"Benchmark" + b.Name}
@@ -98,11 +153,10 @@ func Fprint(w io.Writer, bs []*Benchmark) error {
 					haveGMP = true
 					continue
 				}
-				// TODO: Syntax check.
 				name = append(name, fmt.Sprintf("%s:%s", k, config.RawValue))
 			}
 			if haveGMP && gomaxprocs != "1" {
-				if len(name) == 1 {
+				if _, err := strconv.Atoi(gomaxprocs); err == nil && len(name) == 1 {
 					// Use short form.
 					name[0] = fmt.Sprintf("%s-%s", name[0], gomaxprocs)
 				} else {
@@ -121,9 +175,7 @@ func Fprint(w io.Writer, bs []*Benchmark) error {
 			}
 			sort.Sort(resultKeySorter(resultKeys))
 			for _, k := range resultKeys {
-				result := b.Result[k]
-				// TODO: Syntax check k.
-				line = append(line, pretty(result), k)
+				line = append(line, formatResult(b.Result[k]), k)
 			}
 
 			lines = append(lines, line)
@@ -133,48 +185,8 @@ func Fprint(w io.Writer, bs []*Benchmark) error {
 			return i >= 2 && i%2 == 0
 		}
 
-		// Align numeric columns on ".".
-		dwidths := make([]int, 0)
-		for _, line := range lines {
-			for i, elt := range line {
-				dwidth := 0
-				if i := strings.Index(elt, "."); i >= 0 {
-					dwidth = len(elt) - i
-				}
-				if i >= len(dwidths) {
-					dwidths = append(dwidths, dwidth)
-				} else if dwidth > dwidths[i] {
-					dwidths[i] = dwidth
-				}
-			}
-		}
-		for _, line := range lines {
-			for i, elt := range line {
-				if !numeric(i) {
-					continue
-				}
-				dwidth := dwidths[i]
-				if i := strings.Index(elt, "."); i == -1 {
-					elt += strings.Repeat(" ", dwidth)
-				} else {
-					cur := len(elt) - i
-					elt += strings.Repeat(" ", dwidth-cur)
-				}
-				line[i] = elt
-			}
-		}
-
-		// Compute column widths.
-		widths := make([]int, 0)
-		for _, line := range lines {
-			for i, elt := range line {
-				if i >= len(widths) {
-					widths = append(widths, len(elt))
-				} else if len(elt) > widths[i] {
-					widths[i] = len(elt)
-				}
-			}
-		}
+		alignDecimals(lines, numeric)
+		widths := columnWidths(lines)
 
 		// Print lines.
 		for _, line := range lines {
@@ -204,6 +216,150 @@ func Fprint(w io.Writer, bs []*Benchmark) error {
 	return nil
 }
 
+// checkBenchmark returns an error if b's name, benchmark line
+// configuration, iterations, or results can't be written on a
+// benchmark line that Parse would read back identically.
+func checkBenchmark(b *Benchmark) error {
+	if strings.Contains(b.Name, "/") || containsSpace(b.Name) {
+		return fmt.Errorf("benchmark name %q must not contain whitespace or \"/\"", b.Name)
+	}
+	// Determine how Fprint will print the name.
+	slash := false      // Configuration printed as "/key:value"
+	gomaxprocs := false // GOMAXPROCS printed as "-N"
+	for k, c := range b.Config {
+		if c.InBlock {
+			continue
+		}
+		if strings.ContainsAny(k, "/:") || containsSpace(k) {
+			return fmt.Errorf("benchmark %s: configuration key %q must not contain whitespace, \"/\", or \":\"", b.Name, k)
+		}
+		if strings.ContainsAny(c.RawValue, "/") || containsSpace(c.RawValue) {
+			return fmt.Errorf("benchmark %s: configuration %s value %q must not contain whitespace or \"/\"", b.Name, k, c.RawValue)
+		}
+		if k == "gomaxprocs" {
+			if c.RawValue == "1" {
+				continue
+			}
+			if _, err := strconv.Atoi(c.RawValue); err == nil {
+				gomaxprocs = true
+				continue
+			}
+		}
+		slash = true
+	}
+	if b.Name == "" {
+		if slash || gomaxprocs {
+			return fmt.Errorf("benchmark with empty name must not have benchmark line configuration")
+		}
+	} else if r, _ := utf8.DecodeRuneInString(b.Name); !unicode.IsUpper(r) {
+		return fmt.Errorf("benchmark name %q must start with an upper case letter", b.Name)
+	}
+	if !slash && !gomaxprocs {
+		// Parse would interpret a "-N" suffix as GOMAXPROCS.
+		if i := strings.LastIndex(b.Name, "-"); i >= 0 {
+			if _, err := strconv.Atoi(b.Name[i+1:]); err == nil {
+				return fmt.Errorf("benchmark name %q must not end in -N", b.Name)
+			}
+		}
+	}
+	if b.Iterations <= 0 {
+		return fmt.Errorf("benchmark %s: iterations must be positive, not %d", b.Name, b.Iterations)
+	}
+	if len(b.Result) == 0 {
+		return fmt.Errorf("benchmark %s: no results", b.Name)
+	}
+	for unit := range b.Result {
+		if unit == "" || containsSpace(unit) {
+			return fmt.Errorf("benchmark %s: result unit %q must be non-empty and must not contain whitespace", b.Name, unit)
+		}
+	}
+	return nil
+}
+
+// checkBlockConfig returns an error if key and value can't be written
+// as a configuration line that Parse would read back identically.
+func checkBlockConfig(key, value string) error {
+	if strings.ContainsAny(value, "\n") || strings.HasSuffix(value, "\r") {
+		return fmt.Errorf("bad configuration %s value %q: must not contain newlines", key, value)
+	}
+	m := configRe.FindStringSubmatch(key + ": " + value)
+	if m == nil || m[1] != key {
+		return fmt.Errorf("bad configuration key %q: must start with a lower case letter and must not contain upper case letters, whitespace, or \": \"", key)
+	}
+	if m[2] != value {
+		return fmt.Errorf("bad configuration %s value %q: must not have leading whitespace", key, value)
+	}
+	if key == "testing" && value == "warning: no tests to run" {
+		return fmt.Errorf("configuration %s value %q is ignored by Parse", key, value)
+	}
+	return nil
+}
+
+func containsSpace(s string) bool {
+	return strings.IndexFunc(s, unicode.IsSpace) >= 0
+}
+
+// formatResult formats a result value with at least three
+// significant figures, using more if necessary to represent v
+// exactly.
+func formatResult(v float64) string {
+	s := pretty(v)
+	if x, err := strconv.ParseFloat(s, 64); err == nil && x == v {
+		return s
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// alignDecimals pads the elements of the numeric columns of lines on
+// the right so that they align on "." when right-aligned.
+func alignDecimals(lines [][]string, numeric func(i int) bool) {
+	dwidths := make([]int, 0)
+	for _, line := range lines {
+		for i, elt := range line {
+			dwidth := 0
+			if i := strings.Index(elt, "."); i >= 0 {
+				dwidth = len(elt) - i
+			}
+			if i >= len(dwidths) {
+				dwidths = append(dwidths, dwidth)
+			} else if dwidth > dwidths[i] {
+				dwidths[i] = dwidth
+			}
+		}
+	}
+	for _, line := range lines {
+		for i, elt := range line {
+			if !numeric(i) || elt == "" {
+				continue
+			}
+			dwidth := dwidths[i]
+			if i := strings.Index(elt, "."); i == -1 {
+				elt += strings.Repeat(" ", dwidth)
+			} else {
+				cur := len(elt) - i
+				elt += strings.Repeat(" ", dwidth-cur)
+			}
+			line[i] = elt
+		}
+	}
+}
+
+// columnWidths returns the width of the widest element in each
+// column of lines.
+func columnWidths(lines [][]string) []int {
+	widths := make([]int, 0)
+	for _, line := range lines {
+		for i, elt := range line {
+			if i >= len(widths) {
+				widths = append(widths, len(elt))
+			} else if len(elt) > widths[i] {
+				widths[i] = len(elt)
+			}
+		}
+	}
+	return widths
+}
+
 var fixedKeys = map[string]int{
 	"ns/op": -2,
 	"MB/s":  -1,
@@ -231,7 +387,10 @@ func (s resultKeySorter) Swap(i, j int) {
 // figures.
 func pretty(val float64) string {
 	var prec int
-	for xval := val; xval < 99.95; xval *= 10 {
+	if val == 0 || math.IsNaN(val) || math.IsInf(val, 0) {
+		return fmt.Sprint(val)
+	}
+	for xval := math.Abs(val); xval < 99.95; xval *= 10 {
 		prec++
 	}
 	return fmt.Sprintf("%.*f", prec, val)
@@ -0,0 +1,193 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// benchmarkList is a random list of Benchmarks that can be
+// represented in the benchmark format.
+type benchmarkList []*Benchmark
+
+func randString(r *rand.Rand, first, rest string, maxLen int) string {
+	f, rs := []rune(first), []rune(rest)
+	s := []rune{f[r.Intn(len(f))]}
+	for n := r.Intn(maxLen); n > 0; n-- {
+		s = append(s, rs[r.Intn(len(rs))])
+	}
+	return string(s)
+}
+
+const (
+	lower = "abcxyzé"
+	upper = "ABCXYZÉ"
+	digit = "0123456789"
+)
+
+func (benchmarkList) Generate(r *rand.Rand, size int) reflect.Value {
+	var bs benchmarkList
+	block := map[string]*Config{}
+	var units map[string]Unit
+	for n := r.Intn(size + 1); n > 0; n-- {
+		// Change some unit metadata.
+		if r.Intn(4) == 0 {
+			u := Unit{
+				Name:     randString(r, lower+upper+digit+"%/-", lower+upper+digit+"%/-", 20),
+				Better:   Direction(r.Intn(3) - 1),
+				Quantity: []string{"", "ns", "MB"}[r.Intn(3)],
+				Scale:    []string{"", "auto", "none", "ms"}[r.Intn(4)],
+			}
+			nunits := map[string]Unit{u.Name: u}
+			for name, u := range units {
+				nunits[name] = u
+			}
+			units = nunits
+		}
+
+		// Change some block configuration.
+		for i := r.Intn(3); i > 0; i-- {
+			k := randString(r, lower, lower+digit+":.-_", 8)
+			v := ""
+			if r.Intn(4) > 0 {
+				v = randString(r, upper+lower+digit+":/.", upper+lower+digit+" \t:/.-", 12)
+			}
+			block[k] = &Config{RawValue: v, InBlock: true}
+		}
+
+		b := &Benchmark{
+			Name:       randString(r, upper, upper+lower+digit+"_.:", 10),
+			Iterations: 1 + r.Intn(1000000),
+			Config:     map[string]*Config{},
+			Result:     map[string]float64{},
+			Units:      units,
+		}
+		for k, c := range block {
+			b.Config[k] = c
+		}
+		for i := r.Intn(3); i > 0; i-- {
+			k := randString(r, lower, lower+upper+digit+".-_", 8)
+			v := randString(r, lower+upper+digit+":.-", lower+upper+digit+":.-", 8)
+			b.Config[k] = &Config{RawValue: v}
+		}
+		if r.Intn(4) > 0 {
+			b.Config["gomaxprocs"] = &Config{RawValue: strconv.Itoa(1 + r.Intn(64))}
+		} else {
+			b.Config["gomaxprocs"] = &Config{RawValue: "1"}
+		}
+		for i := 1 + r.Intn(4); i > 0; i-- {
+			unit := randString(r, lower+upper+digit+"%/-", lower+upper+digit+"%/-", 20)
+			var v float64
+			switch r.Intn(4) {
+			case 0:
+				v = float64(r.Intn(100000))
+			case 1:
+				v = r.NormFloat64() * math.Pow(10, float64(r.Intn(20)-10))
+			case 2:
+				v = math.Float64frombits(r.Uint64())
+				if math.IsNaN(v) {
+					v = math.Inf(1)
+				}
+			case 3:
+				v = float64(r.Intn(1000)) / 100
+			}
+			b.Result[unit] = v
+		}
+		bs = append(bs, b)
+	}
+	return reflect.ValueOf(bs)
+}
+
+func TestPrintRoundTrip(t *testing.T) {
+	roundTrip := func(bs benchmarkList) bool {
+		var buf bytes.Buffer
+		if err := Fprint(&buf, bs); err != nil {
+			t.Errorf("unexpected Fprint error: %v", err)
+			return false
+		}
+		got, err := Parse(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Errorf("unexpected Parse error: %v", err)
+			return false
+		}
+		if len(bs) == 0 && len(got) == 0 {
+			return true
+		}
+		if !reflect.DeepEqual([]*Benchmark(bs), got) {
+			t.Logf("Fprint output:\n%s", buf.String())
+			for i := range bs {
+				t.Logf("want %v", bs[i])
+				if i < len(got) {
+					t.Logf("got  %v", got[i])
+				}
+			}
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPrintInvalid(t *testing.T) {
+	good := func() *Benchmark {
+		return &Benchmark{
+			Name:       "X",
+			Iterations: 1,
+			Config:     map[string]*Config{"gomaxprocs": {RawValue: "1"}},
+			Result:     map[string]float64{"ns/op": 1},
+		}
+	}
+	for _, test := range []struct {
+		modify func(b *Benchmark)
+		err    string
+	}{
+		{func(b *Benchmark) { b.Name = "x" }, "upper case"},
+		{func(b *Benchmark) { b.Name = "X Y" }, "whitespace"},
+		{func(b *Benchmark) { b.Name = "X/Y" }, `"/"`},
+		{func(b *Benchmark) { b.Name = "X-4" }, "-N"},
+		{func(b *Benchmark) { b.Name = ""; b.Config["a"] = &Config{RawValue: "1"} }, "empty name"},
+		{func(b *Benchmark) { b.Config["a b"] = &Config{RawValue: "1"} }, "key"},
+		{func(b *Benchmark) { b.Config["a:b"] = &Config{RawValue: "1"} }, "key"},
+		{func(b *Benchmark) { b.Config["a"] = &Config{RawValue: "1/2"} }, "value"},
+		{func(b *Benchmark) { b.Config["a"] = &Config{RawValue: "1 2"} }, "value"},
+		{func(b *Benchmark) { b.Config["Key"] = &Config{RawValue: "1", InBlock: true} }, "key"},
+		{func(b *Benchmark) { b.Config["a b"] = &Config{RawValue: "1", InBlock: true} }, "key"},
+		{func(b *Benchmark) { b.Config["a"] = &Config{RawValue: " 1", InBlock: true} }, "leading whitespace"},
+		{func(b *Benchmark) { b.Config["a"] = &Config{RawValue: "1\n2", InBlock: true} }, "newlines"},
+		{func(b *Benchmark) { b.Iterations = 0 }, "iterations"},
+		{func(b *Benchmark) { b.Result = map[string]float64{} }, "no results"},
+		{func(b *Benchmark) { b.Result["ns op"] = 1 }, "unit"},
+		{func(b *Benchmark) { b.Result[""] = 1 }, "unit"},
+	} {
+		b := good()
+		test.modify(b)
+		var buf bytes.Buffer
+		err := Fprint(&buf, []*Benchmark{b})
+		if err == nil {
+			t.Errorf("Fprint(%v): want error containing %q, got output:\n%s", b, test.err, buf.String())
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Fprint(%v): want error containing %q, got %v", b, test.err, err)
+		}
+		if err != nil && buf.Len() != 0 {
+			t.Errorf("Fprint(%v): wrote output despite error", b)
+		}
+	}
+
+	// Block configuration can't be unset.
+	b1, b2 := good(), good()
+	b1.Config["commit"] = &Config{RawValue: "1", InBlock: true}
+	if err := Fprint(new(bytes.Buffer), []*Benchmark{b1, b2}); err == nil || !strings.Contains(err.Error(), "missing block") {
+		t.Errorf("want missing block configuration error, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A Reader reads benchmarks one at a time from a benchmark results
+// file. Unlike Parse, it does not hold the whole file in memory and
+// can report lines it does not understand.
+//
+// Lines have no length limit.
+type Reader struct {
+	// Warn, if non-nil, is called for each benchmark or unit
+	// metadata line that Reader skips because it is malformed and
+	// for each field of a benchmark line that Reader ignores.
+	// Other lines that aren't configuration lines are not
+	// reported, since benchmark results are often interleaved
+	// with other output.
+	Warn func(*SyntaxError)
+
+	r      *bufio.Reader
+	config map[string]*Config
+	units  map[string]Unit
+	b      *Benchmark
+	line   int // Line number of the most recently read line
+	bline  int // Line number of b
+	err    error
+}
+
+// A SyntaxError describes a malformed or partly ignored line of a
+// benchmark results file.
+type SyntaxError struct {
+	// Line is the 1-based line number.
+	Line int
+
+	// Text is the text of the line.
+	Text string
+
+	// Msg describes the problem.
+	Msg string
+
+	// Skipped indicates that the whole line was skipped.
+	// Otherwise, Reader ignored only part of the line.
+	Skipped bool
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// NewReader returns a Reader that reads benchmarks from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		r:      bufio.NewReader(r),
+		config: make(map[string]*Config),
+	}
+}
+
+// Next advances to the next benchmark, which will then be available
+// through Benchmark. It returns false when there are no more
+// benchmarks, either because it reached the end of the input or
+// because of an error. After Next returns false, Err returns the
+// error, if any.
+func (r *Reader) Next() bool {
+	r.b = nil
+	for r.err == nil {
+		line, err := r.r.ReadString('\n')
+		if err != nil {
+			r.err = err
+			if line == "" {
+				break
+			}
+		}
+		r.line++
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "testing: warning: no tests to run" {
+			continue
+		}
+
+		// Configuration lines.
+		m := configRe.FindStringSubmatch(line)
+		if m != nil {
+			r.config[m[1]] = &Config{RawValue: m[2], InBlock: true}
+			continue
+		}
+
+		// Unit metadata lines.
+		if u, ok, err := parseUnitLine(line); ok {
+			if err != nil {
+				r.warn(line, err.Error(), true)
+				continue
+			}
+			// Benchmarks share the units map, so copy it
+			// before modifying it.
+			units := map[string]Unit{u.Name: u}
+			for name, old := range r.units {
+				if name != u.Name {
+					units[name] = old
+				}
+			}
+			r.units = units
+			continue
+		}
+
+		// Benchmark lines.
+		if strings.HasPrefix(line, "Benchmark") {
+			b, skipped, err := parseBenchmark(line, r.config)
+			if err != nil {
+				r.warn(line, err.Error(), true)
+				continue
+			}
+			b.Units = r.units
+			for _, msg := range skipped {
+				r.warn(line, msg, false)
+			}
+			r.b, r.bline = b, r.line
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reader) warn(line, msg string, skipped bool) {
+	if r.Warn != nil {
+		r.Warn(&SyntaxError{r.line, line, msg, skipped})
+	}
+}
+
+// Benchmark returns the benchmark read by the most recent call to
+// Next.
+func (r *Reader) Benchmark() *Benchmark {
+	return r.b
+}
+
+// Line returns the 1-based line number of the benchmark returned by
+// Benchmark.
+func (r *Reader) Line() int {
+	return r.bline
+}
+
+// Err returns the first non-EOF error encountered by the Reader.
+func (r *Reader) Err() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
@@ -0,0 +1,70 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	input := `commit: 123
+BenchmarkX	1	2 ns/op
+PASS
+Benchmarkx	1	2 ns/op
+BenchmarkX
+BenchmarkX	one	2 ns/op
+BenchmarkX	1	2
+BenchmarkX	1	2 ns/op bad 3 MB/s
+BenchmarkY-4	5	6 ns/op`
+	type warning struct {
+		line    int
+		skipped bool
+	}
+	var warnings []warning
+	r := NewReader(strings.NewReader(input))
+	r.Warn = func(e *SyntaxError) {
+		warnings = append(warnings, warning{e.Line, e.Skipped})
+	}
+	var names []string
+	var lines []int
+	for r.Next() {
+		names = append(names, r.Benchmark().Name)
+		lines = append(lines, r.Line())
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if want := []string{"X", "X", "Y"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("want benchmarks %v, got %v", want, names)
+	}
+	if want := []int{2, 8, 9}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("want lines %v, got %v", want, lines)
+	}
+	want := []warning{{4, true}, {5, true}, {6, true}, {7, true}, {8, false}}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("want warnings %v, got %v", want, warnings)
+	}
+}
+
+func TestReaderLongLine(t *testing.T) {
+	// Construct a benchmark line much longer than bufio.Scanner's
+	// default limit.
+	var line strings.Builder
+	line.WriteString("BenchmarkX 1")
+	const n = 20000
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&line, " %d unit%d", i, i)
+	}
+	bs, err := Parse(strings.NewReader(line.String() + "\nBenchmarkY 1 2 ns/op\n"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(bs) != 2 || len(bs[0].Result) != n || bs[1].Name != "Y" {
+		t.Fatalf("want 2 benchmarks with %d and 1 results", n)
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// An Aggregator combines the results of repeated runs of a benchmark
+// into a single value. values is never empty.
+type Aggregator func(values []float64) float64
+
+// Median returns the median of values.
+func Median(values []float64) float64 {
+	s := append([]float64(nil), values...)
+	sort.Float64s(s)
+	if len(s)%2 == 1 {
+		return s[len(s)/2]
+	}
+	return (s[len(s)/2-1] + s[len(s)/2]) / 2
+}
+
+// Mean returns the arithmetic mean of values.
+func Mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// Min returns the smallest of values.
+func Min(values []float64) float64 {
+	m := values[0]
+	for _, v := range values[1:] {
+		m = math.Min(m, v)
+	}
+	return m
+}
+
+// Max returns the largest of values.
+func Max(values []float64) float64 {
+	m := values[0]
+	for _, v := range values[1:] {
+		m = math.Max(m, v)
+	}
+	return m
+}
+
+// Aggregators maps the names of the standard Aggregators to their
+// functions.
+var Aggregators = map[string]Aggregator{
+	"median": Median,
+	"mean":   Mean,
+	"min":    Min,
+	"max":    Max,
+}
+
+// A Table is a pivot table of one result unit as a function of
+// configuration values.
+type Table struct {
+	// Unit is the result unit shown in the table.
+	Unit string
+
+	// Info describes Unit.
+	Info Unit
+
+	// RowKeys and ColKeys are the configuration keys that
+	// determine the rows and columns. The key "name" refers to
+	// the benchmark name.
+	RowKeys, ColKeys []string
+
+	// Rows and Cols are the labels of each row and column. Each
+	// label is the values of RowKeys or ColKeys, separated by "/".
+	Rows, Cols []string
+
+	// Cells[i][j] is the aggregated result for Rows[i] and
+	// Cols[j], or NaN if there are no results for that cell.
+	Cells [][]float64
+}
+
+// NewTable builds a Table of the results in unit from bs, grouping
+// benchmarks into rows by the values of rowKeys and into columns by
+// the values of colKeys, and combining the results in each cell with
+// agg. Either list of keys may be empty, in which case the table has
+// a single row or column. Benchmarks without a result in unit are
+// ignored and benchmarks without a given key are grouped under an
+// empty value for that key.
+//
+// Rows and columns are ordered by their values, which are compared
+// by type as in Query.
+func NewTable(bs []*Benchmark, rowKeys, colKeys []string, unit string, agg Aggregator) *Table {
+	t := &Table{Unit: unit, Info: LookupUnit(unit), RowKeys: rowKeys, ColKeys: colKeys}
+
+	type group struct {
+		label  string
+		values []*Config
+	}
+	groupOf := func(b *Benchmark, keys []string) group {
+		g := group{values: make([]*Config, len(keys))}
+		labels := make([]string, len(keys))
+		for i, k := range keys {
+			c := b.Config[k]
+			if k == "name" {
+				c = &Config{Value: b.Name, RawValue: b.Name}
+			} else if c == nil {
+				c = &Config{Value: "", RawValue: ""}
+			}
+			g.values[i] = c
+			labels[i] = c.RawValue
+		}
+		g.label = strings.Join(labels, "/")
+		return g
+	}
+
+	// Collect the results in each cell.
+	rows, cols := map[string]group{}, map[string]group{}
+	type cellKey struct{ row, col string }
+	cells := map[cellKey][]float64{}
+	for _, b := range bs {
+		v, ok := b.Result[unit]
+		if !ok {
+			continue
+		}
+		if len(cells) == 0 {
+			t.Info = b.Unit(unit)
+		}
+		r, c := groupOf(b, rowKeys), groupOf(b, colKeys)
+		rows[r.label], cols[c.label] = r, c
+		k := cellKey{r.label, c.label}
+		cells[k] = append(cells[k], v)
+	}
+
+	// Order the rows and columns.
+	sorted := func(groups map[string]group) []string {
+		var gs []group
+		for _, g := range groups {
+			gs = append(gs, g)
+		}
+		sort.Slice(gs, func(i, j int) bool {
+			for k, a := range gs[i].values {
+				if cmp, ok := compareConfig(a, gs[j].values[k].RawValue); ok && cmp != 0 {
+					return cmp < 0
+				}
+			}
+			return gs[i].label < gs[j].label
+		})
+		labels := make([]string, len(gs))
+		for i, g := range gs {
+			labels[i] = g.label
+		}
+		return labels
+	}
+	t.Rows, t.Cols = sorted(rows), sorted(cols)
+
+	t.Cells = make([][]float64, len(t.Rows))
+	for i, r := range t.Rows {
+		t.Cells[i] = make([]float64, len(t.Cols))
+		for j, c := range t.Cols {
+			if vs := cells[cellKey{r, c}]; len(vs) > 0 {
+				t.Cells[i][j] = agg(vs)
+			} else {
+				t.Cells[i][j] = math.NaN()
+			}
+		}
+	}
+	return t
+}
+
+// header returns the header row of t, using unit as the name of the
+// result unit.
+func (t *Table) header(unit string) []string {
+	corner := strings.Join(t.RowKeys, "/")
+	if corner == "" {
+		corner = unit
+	}
+	h := []string{corner}
+	for _, c := range t.Cols {
+		if len(t.ColKeys) == 0 {
+			h = append(h, unit)
+		} else {
+			h = append(h, strings.Join(t.ColKeys, "/")+":"+c)
+		}
+	}
+	return h
+}
+
+// lines returns the header and rows of t with cells formatted by
+// format. If scaled is true, cells are scaled for display as
+// described by t.Info. It also returns the name of the unit of the
+// formatted cells.
+func (t *Table) lines(format func(float64) string, scaled bool) ([][]string, string) {
+	scale, unit := func(v float64) float64 { return v }, t.Unit
+	if scaled {
+		var all []float64
+		for _, row := range t.Cells {
+			all = append(all, row...)
+		}
+		scale, unit = t.Info.Scaler(median(all))
+	}
+	lines := [][]string{t.header(unit)}
+	for i, r := range t.Rows {
+		line := []string{r}
+		for _, v := range t.Cells[i] {
+			if math.IsNaN(v) {
+				line = append(line, "")
+			} else {
+				line = append(line, format(scale(v)))
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines, unit
+}
+
+// Fprint prints t to w as a text table with cells aligned on the
+// decimal point, in the same style as the benchmark format. Cells are
+// scaled for display as described by t.Info.
+func (t *Table) Fprint(w io.Writer) error {
+	lines, unit := t.lines(pretty, true)
+	if len(t.RowKeys) > 0 {
+		// The header doesn't show the unit, so add a title.
+		if _, err := fmt.Fprintf(w, "%s\n", unit); err != nil {
+			return err
+		}
+	}
+	// Align cells only within the body, so the header doesn't
+	// affect decimal alignment.
+	alignDecimals(lines[1:], func(i int) bool { return i > 0 })
+	widths := columnWidths(lines)
+	for _, line := range lines {
+		for i, elt := range line {
+			var err error
+			if i == 0 {
+				_, err = fmt.Fprintf(w, "%-*s", widths[i], elt)
+			} else {
+				_, err = fmt.Fprintf(w, "  %*s", widths[i], elt)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprint(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FprintCSV prints t to w as CSV. Cells are printed with full
+// precision and empty cells are left blank.
+func (t *Table) FprintCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	lines, _ := t.lines(func(v float64) string {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}, false)
+	err := cw.WriteAll(lines)
+	if err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// FprintMarkdown prints t to w as a Markdown table. Cells are scaled
+// for display as described by t.Info.
+func (t *Table) FprintMarkdown(w io.Writer) error {
+	lines, unit := t.lines(pretty, true)
+	escape := strings.NewReplacer("|", `\|`)
+	if len(t.RowKeys) > 0 {
+		if _, err := fmt.Fprintf(w, "%s\n\n", escape.Replace(unit)); err != nil {
+			return err
+		}
+	}
+	for i, line := range lines {
+		for j := range line {
+			line[j] = escape.Replace(line[j])
+		}
+		if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(line, " | ")); err != nil {
+			return err
+		}
+		if i == 0 {
+			sep := []string{"---"}
+			for range line[1:] {
+				sep = append(sep, "---:")
+			}
+			if _, err := fmt.Fprintf(w, "|%s|\n", strings.Join(sep, "|")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+const tableTestInput = `BenchmarkLargeHeap/retain:1GB/gcpercent:100 1 2000000 ns/op 3 GCs/op
+BenchmarkLargeHeap/retain:1GB/gcpercent:100 1 4000000 ns/op 5 GCs/op
+BenchmarkLargeHeap/retain:1GB/gcpercent:100 1 9000000 ns/op 4 GCs/op
+BenchmarkLargeHeap/retain:64MB/gcpercent:100 1 500000 ns/op 10 GCs/op
+BenchmarkLargeHeap/retain:64MB/gcpercent:200 1 250000 ns/op 5 GCs/op
+BenchmarkLargeHeap/retain:512MB/gcpercent:200 1 1500000 ns/op
+BenchmarkChurn/gcpercent:100 1 12500000 ns/op
+`
+
+func TestNewTable(t *testing.T) {
+	bs := mustParse(t, tableTestInput)
+
+	tab := NewTable(bs, []string{"name", "retain"}, []string{"gcpercent"}, "ns/op", Median)
+	// Byte sizes are ordered numerically and a missing key sorts
+	// as an empty string.
+	if want := []string{"Churn/", "LargeHeap/64MB", "LargeHeap/512MB", "LargeHeap/1GB"}; !reflect.DeepEqual(tab.Rows, want) {
+		t.Errorf("rows are %q, want %q", tab.Rows, want)
+	}
+	if want := []string{"100", "200"}; !reflect.DeepEqual(tab.Cols, want) {
+		t.Errorf("columns are %q, want %q", tab.Cols, want)
+	}
+	nan := math.NaN()
+	want := [][]float64{
+		{12500000, nan},
+		{500000, 250000},
+		{nan, 1500000},
+		{4000000, nan},
+	}
+	for i := range want {
+		for j := range want[i] {
+			if !same(tab.Cells[i][j], want[i][j]) {
+				t.Errorf("cell %s,%s = %v, want %v", tab.Rows[i], tab.Cols[j], tab.Cells[i][j], want[i][j])
+			}
+		}
+	}
+
+	// With no keys, there is a single cell.
+	tab = NewTable(bs, nil, nil, "GCs/op", Max)
+	if len(tab.Rows) != 1 || len(tab.Cols) != 1 || tab.Cells[0][0] != 10 {
+		t.Errorf("table without keys: rows %q, cols %q, cells %v", tab.Rows, tab.Cols, tab.Cells)
+	}
+}
+
+func TestTablePrint(t *testing.T) {
+	bs := mustParse(t, tableTestInput)
+	rowsCols := NewTable(bs, []string{"name", "retain"}, []string{"gcpercent"}, "ns/op", Median)
+	rowsOnly := NewTable(bs, []string{"retain"}, nil, "GCs/op", Mean)
+	colsOnly := NewTable(bs, nil, []string{"retain"}, "GCs/op", Min)
+
+	for _, test := range []struct {
+		name  string
+		print func(*Table, io.Writer) error
+		tab   *Table
+		want  string
+	}{
+		{"text", (*Table).Fprint, rowsCols,
+			"ms/op\n" +
+				"name/retain      gcpercent:100  gcpercent:200\n" +
+				"Churn/                  12.5                 \n" +
+				"LargeHeap/64MB           0.500          0.250\n" +
+				"LargeHeap/512MB                         1.50 \n" +
+				"LargeHeap/1GB            4.00                \n"},
+		{"text", (*Table).Fprint, rowsOnly,
+			"GCs/op\n" +
+				"retain  GCs/op\n" +
+				"64MB      7.50\n" +
+				"1GB       4.00\n"},
+		{"text", (*Table).Fprint, colsOnly,
+			"GCs/op  retain:64MB  retain:1GB\n" +
+				"               5.00        3.00\n"},
+		{"CSV", (*Table).FprintCSV, rowsCols, `name/retain,gcpercent:100,gcpercent:200
+Churn/,1.25e+07,
+LargeHeap/64MB,500000,250000
+LargeHeap/512MB,,1.5e+06
+LargeHeap/1GB,4e+06,
+`},
+		{"CSV", (*Table).FprintCSV, colsOnly, `GCs/op,retain:64MB,retain:1GB
+,5,3
+`},
+		{"Markdown", (*Table).FprintMarkdown, rowsCols, `ms/op
+
+| name/retain | gcpercent:100 | gcpercent:200 |
+|---|---:|---:|
+| Churn/ | 12.5 |  |
+| LargeHeap/64MB | 0.500 | 0.250 |
+| LargeHeap/512MB |  | 1.50 |
+| LargeHeap/1GB | 4.00 |  |
+`},
+		{"Markdown", (*Table).FprintMarkdown, colsOnly, `| GCs/op | retain:64MB | retain:1GB |
+|---|---:|---:|
+|  | 5.00 | 3.00 |
+`},
+	} {
+		var buf bytes.Buffer
+		if err := test.print(test.tab, &buf); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("%s of %s table: got\n%s\nwant\n%s", test.name, test.tab.Unit, got, test.want)
+		}
+	}
+}
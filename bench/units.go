@@ -0,0 +1,348 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Direction indicates whether larger or smaller values of a result
+// unit are better.
+type Direction int
+
+const (
+	DirectionUnknown Direction = 0
+	LowerIsBetter    Direction = -1
+	HigherIsBetter   Direction = 1
+)
+
+func (d Direction) String() string {
+	switch d {
+	case LowerIsBetter:
+		return "lower"
+	case HigherIsBetter:
+		return "higher"
+	}
+	return "unknown"
+}
+
+// A Unit describes how to interpret and display the values of a
+// result unit.
+//
+// Units can be described in benchmark files by unit metadata lines
+// of the form
+//
+//	Unit <name> [better=higher|lower] [quantity=<q>] [scale=<s>]
+//
+// which apply to results in that unit on all following benchmark
+// lines.
+type Unit struct {
+	// Name is the result unit, as in Benchmark.Result.
+	Name string
+
+	// Better indicates whether larger or smaller values are
+	// better.
+	Better Direction
+
+	// Quantity is the measurement unit of the values, such as
+	// "ns" or "MB", or "" if they are dimensionless. See
+	// Quantities for the known measurement units.
+	Quantity string
+
+	// Scale is the preferred way to display the values. If it is
+	// "" or "none", values are displayed as is. If it is "auto",
+	// values are displayed in the measurement unit of the same
+	// dimension as Quantity that best suits their magnitude.
+	// Otherwise, it is a measurement unit of the same dimension
+	// as Quantity, such as "ms", to display values in.
+	Scale string
+}
+
+// A Quantity is a measurement unit of a Unit's values.
+type Quantity struct {
+	// Dimension is the base unit of this quantity's dimension,
+	// "s" for time or "B" for bytes.
+	Dimension string
+
+	// Factor is the size of this quantity in Dimension.
+	Factor float64
+}
+
+// Quantities maps the measurement units that may appear in result
+// unit names to their dimension and size.
+var Quantities = map[string]Quantity{
+	"ns":  {"s", 1e-9},
+	"us":  {"s", 1e-6},
+	"µs":  {"s", 1e-6},
+	"ms":  {"s", 1e-3},
+	"s":   {"s", 1},
+	"sec": {"s", 1},
+
+	"B":   {"B", 1},
+	"kB":  {"B", 1e3},
+	"KB":  {"B", 1e3},
+	"MB":  {"B", 1e6},
+	"GB":  {"B", 1e9},
+	"TB":  {"B", 1e12},
+	"KiB": {"B", 1 << 10},
+	"MiB": {"B", 1 << 20},
+	"GiB": {"B", 1 << 30},
+	"TiB": {"B", 1 << 40},
+}
+
+// autoScales lists the measurement units Scale "auto" chooses from
+// for each dimension, in increasing size.
+var autoScales = map[string][]string{
+	"s": {"ns", "µs", "ms", "s"},
+	"B": {"B", "kB", "MB", "GB", "TB"},
+}
+
+var unitRegistry = struct {
+	sync.Mutex
+	m map[string]Unit
+}{m: make(map[string]Unit)}
+
+// RegisterUnit registers u as the description of the result unit
+// u.Name, replacing any earlier description.
+func RegisterUnit(u Unit) {
+	unitRegistry.Lock()
+	defer unitRegistry.Unlock()
+	unitRegistry.m[u.Name] = u
+}
+
+func init() {
+	for _, u := range []Unit{
+		// Standard testing package units.
+		{Name: "ns/op", Better: LowerIsBetter, Quantity: "ns", Scale: "auto"},
+		{Name: "MB/s", Better: HigherIsBetter, Quantity: "MB"},
+		{Name: "B/op", Better: LowerIsBetter, Quantity: "B"},
+		{Name: "allocs/op", Better: LowerIsBetter},
+
+		// gcbench metrics.
+		{Name: "GCs/op", Better: LowerIsBetter},
+		{Name: "GCs/sec", Better: LowerIsBetter},
+		{Name: "95%ile-ns/sweepTerm", Better: LowerIsBetter, Quantity: "ns", Scale: "auto"},
+		{Name: "95%ile-ns/markTerm", Better: LowerIsBetter, Quantity: "ns", Scale: "auto"},
+		{Name: "MB-marked/CPU/sec", Better: HigherIsBetter, Quantity: "MB"},
+		{Name: "95%ile-heap-overshoot", Better: LowerIsBetter},
+		// Heap undershoot isn't necessarily bad, so the 5th
+		// percentile overshoot has no better direction.
+		{Name: "5%ile-heap-overshoot"},
+		{Name: "95%ile-CPU-util", Better: LowerIsBetter},
+		{Name: "assist-util", Better: LowerIsBetter},
+		{Name: "churn-missed-ticks", Better: LowerIsBetter},
+		{Name: "churn-achieved-ratio", Better: HigherIsBetter},
+		// The achieved size and allocation rate of a
+		// LifetimeHeap describe the workload rather than how
+		// well it ran.
+		{Name: "lifetime-live-MB", Quantity: "MB"},
+		{Name: "lifetime-alloc-MB/sec", Quantity: "MB"},
+	} {
+		RegisterUnit(u)
+	}
+}
+
+// LookupUnit returns the description of the result unit name. If
+// name has been registered with RegisterUnit, it returns the
+// registered Unit. A name that extends a registered name with a "-"
+// suffix, such as a per-phase metric like "95%ile-CPU-util-ramp1",
+// has the description of the longest such registered name.
+// Otherwise, it infers a description from name: a measurement unit
+// such as "ns" or "MB" before the first "/" gives the Quantity, time
+// values are better lower and displayed with automatic scaling, and
+// rates ending in "/s" or "/sec" are better higher.
+func LookupUnit(name string) Unit {
+	unitRegistry.Lock()
+	u, ok := unitRegistry.m[name]
+	if !ok {
+		for i := strings.LastIndex(name, "-"); i > 0; i = strings.LastIndex(name[:i], "-") {
+			if u, ok = unitRegistry.m[name[:i]]; ok {
+				u.Name = name
+				break
+			}
+		}
+	}
+	unitRegistry.Unlock()
+	if ok {
+		return u
+	}
+
+	u = Unit{Name: name}
+	if start, end := quantityToken(name); start >= 0 {
+		u.Quantity = name[start:end]
+	}
+	switch {
+	case Quantities[u.Quantity].Dimension == "s":
+		u.Better, u.Scale = LowerIsBetter, "auto"
+	case strings.HasSuffix(name, "/s") || strings.HasSuffix(name, "/sec"):
+		u.Better = HigherIsBetter
+	}
+	return u
+}
+
+// quantityToken returns the byte range of the first measurement unit
+// in Quantities that appears as a word in name before the first "/",
+// or -1, -1 if there is none.
+func quantityToken(name string) (start, end int) {
+	if i := strings.Index(name, "/"); i >= 0 {
+		name = name[:i]
+	}
+	start = -1
+	for i, r := range name + " " {
+		if unicode.IsLetter(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			if _, ok := Quantities[name[start:i]]; ok {
+				return start, i
+			}
+			start = -1
+		}
+	}
+	return -1, -1
+}
+
+// Unit returns the description of result unit name for b. Fields set
+// by unit metadata lines in b's file override those of LookupUnit.
+func (b *Benchmark) Unit(name string) Unit {
+	u := LookupUnit(name)
+	if d, ok := b.Units[name]; ok {
+		if d.Better != DirectionUnknown {
+			u.Better = d.Better
+		}
+		if d.Quantity != "" {
+			u.Quantity = d.Quantity
+		}
+		if d.Scale != "" {
+			u.Scale = d.Scale
+		}
+	}
+	return u
+}
+
+// String returns u as a unit metadata line.
+func (u Unit) String() string {
+	s := "Unit " + u.Name
+	if u.Better != DirectionUnknown {
+		s += " better=" + u.Better.String()
+	}
+	if u.Quantity != "" {
+		s += " quantity=" + u.Quantity
+	}
+	if u.Scale != "" {
+		s += " scale=" + u.Scale
+	}
+	return s
+}
+
+// parseUnitLine parses a unit metadata line. It returns ok == false
+// if line is not a unit metadata line and an error if it is
+// malformed.
+func parseUnitLine(line string) (u Unit, ok bool, err error) {
+	kw, rest := nextField(line)
+	if kw != "Unit" {
+		return Unit{}, false, nil
+	}
+	u.Name, rest = nextField(rest)
+	if u.Name == "" {
+		return Unit{}, true, fmt.Errorf("missing unit name")
+	}
+	for {
+		var kv string
+		kv, rest = nextField(rest)
+		if kv == "" {
+			break
+		}
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			return Unit{}, true, fmt.Errorf("unit metadata %q is not key=value", kv)
+		}
+		k, v := kv[:i], kv[i+1:]
+		switch k {
+		case "better":
+			switch v {
+			case "higher":
+				u.Better = HigherIsBetter
+			case "lower":
+				u.Better = LowerIsBetter
+			default:
+				return Unit{}, true, fmt.Errorf("better must be higher or lower, not %q", v)
+			}
+		case "quantity":
+			if _, ok := Quantities[v]; !ok {
+				return Unit{}, true, fmt.Errorf("unknown quantity %q", v)
+			}
+			u.Quantity = v
+		case "scale":
+			if _, ok := Quantities[v]; !ok && v != "auto" && v != "none" {
+				return Unit{}, true, fmt.Errorf("unknown scale %q", v)
+			}
+			u.Scale = v
+		default:
+			return Unit{}, true, fmt.Errorf("unknown unit metadata key %q", k)
+		}
+	}
+	return u, true, nil
+}
+
+// Scaler returns a function that converts values of u to the
+// preferred display scale, along with the name of the scaled unit.
+// For Scale "auto", the display scale is chosen based on the
+// magnitude of typical.
+func (u Unit) Scaler(typical float64) (scale func(float64) float64, name string) {
+	identity := func(v float64) float64 { return v }
+	q, ok := Quantities[u.Quantity]
+	if !ok || u.Scale == "" || u.Scale == u.Quantity {
+		return identity, u.Name
+	}
+
+	display := u.Scale
+	if display == "auto" {
+		typical = math.Abs(typical) * q.Factor
+		scales := autoScales[q.Dimension]
+		display = scales[0]
+		for _, s := range scales[1:] {
+			if typical >= Quantities[s].Factor {
+				display = s
+			}
+		}
+	}
+	dq, ok := Quantities[display]
+	if !ok || dq.Dimension != q.Dimension {
+		return identity, u.Name
+	}
+	if display == u.Quantity {
+		return identity, u.Name
+	}
+
+	ratio := q.Factor / dq.Factor
+	scale = func(v float64) float64 { return v * ratio }
+	if start, end := quantityToken(u.Name); start >= 0 && u.Name[start:end] == u.Quantity {
+		return scale, u.Name[:start] + display + u.Name[end:]
+	}
+	return scale, u.Name + " (" + display + ")"
+}
+
+// median returns the median of the non-NaN values in vs, or NaN if
+// there are none.
+func median(vs []float64) float64 {
+	var s []float64
+	for _, v := range vs {
+		if !math.IsNaN(v) {
+			s = append(s, v)
+		}
+	}
+	if len(s) == 0 {
+		return math.NaN()
+	}
+	return Median(s)
+}
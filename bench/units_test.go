@@ -0,0 +1,97 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLookupUnit(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		better   Direction
+		quantity string
+	}{
+		{"ns/op", LowerIsBetter, "ns"},
+		{"MB-marked/CPU/sec", HigherIsBetter, "MB"},
+		{"95%ile-heap-overshoot", LowerIsBetter, ""},
+		{"95%ile-heap-overshoot-ramp1", LowerIsBetter, ""},
+		{"5%ile-heap-overshoot-const0", DirectionUnknown, ""},
+		{"assist-util-steady-state", LowerIsBetter, ""},
+		{"P99-latency-ns", LowerIsBetter, "ns"},
+		{"max-server-latency-ns", LowerIsBetter, "ns"},
+		{"reqs/sec", HigherIsBetter, ""},
+		{"widgets", DirectionUnknown, ""},
+	} {
+		u := LookupUnit(test.name)
+		if u.Better != test.better || u.Quantity != test.quantity {
+			t.Errorf("LookupUnit(%q) = %+v; want better %v, quantity %q", test.name, u, test.better, test.quantity)
+		}
+	}
+}
+
+func TestScaler(t *testing.T) {
+	for _, test := range []struct {
+		unit    Unit
+		typical float64
+		v, want float64
+		name    string
+	}{
+		{LookupUnit("95%ile-ns/markTerm"), 5e6, 1.5e6, 1.5, "95%ile-ms/markTerm"},
+		{LookupUnit("95%ile-ns/markTerm"), 500, 500, 500, "95%ile-ns/markTerm"},
+		{LookupUnit("P99-latency-ns"), 2e9, 3e9, 3, "P99-latency-s"},
+		{LookupUnit("MB-marked/CPU/sec"), 1e6, 1e6, 1e6, "MB-marked/CPU/sec"},
+		{Unit{Name: "MB-marked/CPU/sec", Quantity: "MB", Scale: "GB"}, 1, 2000, 2, "GB-marked/CPU/sec"},
+		{Unit{Name: "pause", Quantity: "ns", Scale: "µs"}, 1, 2000, 2, "pause (µs)"},
+		{Unit{Name: "ns/op", Quantity: "ns", Scale: "none"}, 1e9, 1e9, 1e9, "ns/op"},
+	} {
+		scale, name := test.unit.Scaler(test.typical)
+		if got := scale(test.v); got != test.want || name != test.name {
+			t.Errorf("%+v.Scaler(%v): scale(%v) = %v, %q; want %v, %q", test.unit, test.typical, test.v, got, name, test.want, test.name)
+		}
+	}
+}
+
+func TestUnitMetadata(t *testing.T) {
+	input := `Unit widgets better=higher
+BenchmarkX 1 2 widgets 3 ns/op
+Unit ns/op better=higher
+Unit bad better=sideways
+BenchmarkX 1 2 widgets 3 ns/op
+`
+	var warnings int
+	r := NewReader(strings.NewReader(input))
+	r.Warn = func(*SyntaxError) { warnings++ }
+	var bs []*Benchmark
+	for r.Next() {
+		bs = append(bs, r.Benchmark())
+	}
+	if len(bs) != 2 || warnings != 1 {
+		t.Fatalf("want 2 benchmarks and 1 warning, got %d and %d", len(bs), warnings)
+	}
+	if got := bs[0].Unit("widgets").Better; got != HigherIsBetter {
+		t.Errorf("widgets: want better higher, got %v", got)
+	}
+	if got := bs[0].Unit("ns/op").Better; got != LowerIsBetter {
+		t.Errorf("first ns/op: want better lower, got %v", got)
+	}
+	if got := bs[1].Unit("ns/op").Better; got != HigherIsBetter {
+		t.Errorf("second ns/op: want better higher, got %v", got)
+	}
+
+	// Compare should judge changes using the metadata.
+	old := []*Benchmark{bs[0], bs[0], bs[0], bs[0], bs[0]}
+	var new []*Benchmark
+	for i := 0; i < 5; i++ {
+		new = append(new, &Benchmark{Name: "X", Iterations: 1, Config: bs[0].Config, Result: map[string]float64{"widgets": 1, "ns/op": 4}})
+	}
+	for _, c := range Compare(old, new) {
+		want := map[string]int{"widgets": -1, "ns/op": -1}[c.Unit]
+		if got := c.Change(0.05); got != want {
+			t.Errorf("%s: want change %d, got %d", c.Unit, want, got)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aclements/go-gcbench/bench"
+)
+
+func cmdCompare(args []string) {
+	fs := newFlagSet("compare", "[-alpha α] [-filter query] old.txt new.txt", `Compare compares two sets of benchmark results in the standard
+benchmark format. For each benchmark and unit, it prints the mean
+and relative standard deviation of the old and new results and, if
+the difference is statistically significant, the relative change.
+Benchmarks are matched by name and benchmark-line configuration.
+
+`+queryHelp)
+	flagAlpha := fs.Float64("alpha", 0.05, "consider changes significant if p < `α`")
+	filter := flagQuery(fs)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+	}
+
+	old := filter(readBenchmarks(fs.Arg(0)))
+	new := filter(readBenchmarks(fs.Arg(1)))
+	if err := bench.FprintComparisons(os.Stdout, bench.Compare(old, new), *flagAlpha); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// readBenchmarks parses the benchmark results in file path.
+func readBenchmarks(path string) []*bench.Benchmark {
+	f, err := os.Open(path)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	defer f.Close()
+	return readBenchmarksFrom(path, f)
+}
+
+// readBenchmarksFrom parses the benchmark results in r, which is
+// named name, and warns about malformed benchmark lines.
+func readBenchmarksFrom(name string, r io.Reader) []*bench.Benchmark {
+	br := bench.NewReader(r)
+	br.Warn = func(e *bench.SyntaxError) {
+		fmt.Fprintf(os.Stderr, "gcbench: %s:%d: %s\n", name, e.Line, e.Msg)
+	}
+	var bs []*bench.Benchmark
+	for br.Next() {
+		bs = append(bs, br.Benchmark())
+	}
+	if err := br.Err(); err != nil {
+		fatalf("reading %s: %v", name, err)
+	}
+	return bs
+}
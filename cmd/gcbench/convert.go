@@ -0,0 +1,67 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/aclements/go-gcbench/bench"
+)
+
+var readers = map[string]func(io.Reader) ([]*bench.Benchmark, error){
+	"text": bench.Parse,
+	"json": bench.ReadJSON,
+	"csv":  bench.ReadCSV,
+}
+
+var writers = map[string]func(io.Writer, []*bench.Benchmark) error{
+	"text": bench.Fprint,
+	"json": bench.WriteJSON,
+	"csv":  bench.WriteCSV,
+}
+
+func cmdConvert(args []string) {
+	fs := newFlagSet("convert", "[-from format] [-to format] [file]", `Convert converts benchmark results between the standard benchmark
+format ("text"), JSON, and CSV. It reads from file or, if no file is
+given, standard input, and writes to standard output.
+
+When converting from text, configuration values are parsed into
+integers, floats, durations, or strings, and the JSON and CSV output
+records these types.`)
+	flagFrom := fs.String("from", "text", "input `format`")
+	flagTo := fs.String("to", "json", "output `format`")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+	}
+	read, write := readers[*flagFrom], writers[*flagTo]
+	if read == nil {
+		fatalf("unknown format %q", *flagFrom)
+	}
+	if write == nil {
+		fatalf("unknown format %q", *flagTo)
+	}
+
+	in := os.Stdin
+	if fs.NArg() == 1 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fatalf("%v", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	bs, err := read(in)
+	if err != nil {
+		fatalf("reading %s: %v", in.Name(), err)
+	}
+	if *flagFrom == "text" {
+		bench.ParseValues(bs, nil)
+	}
+	if err := write(os.Stdout, bs); err != nil {
+		fatalf("%v", err)
+	}
+}
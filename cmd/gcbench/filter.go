@@ -0,0 +1,68 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/aclements/go-gcbench/bench"
+)
+
+const queryHelp = `A query is a space-separated list of terms of the form "key op value",
+where op is one of : = != < <= > >=. All terms must match. The key
+"name" matches benchmark names against a glob pattern; other keys
+compare configuration values by type, including byte sizes. For
+example:
+
+	name:LargeHeap retain>=1GB heap:AST gomaxprocs:4`
+
+func cmdFilter(args []string) {
+	fs := newFlagSet("filter", "[-units list] query [files...]", `Filter prints the benchmark results from the given files (or standard
+input) that match query, in the standard benchmark format.
+
+`+queryHelp)
+	flagUnits := fs.String("units", "", "print only the comma-separated result `units`")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+	}
+
+	q, err := bench.ParseQuery(fs.Arg(0))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	var bs []*bench.Benchmark
+	if fs.NArg() == 1 {
+		bs = readBenchmarksFrom("<stdin>", os.Stdin)
+	}
+	for _, path := range fs.Args()[1:] {
+		bs = append(bs, readBenchmarks(path)...)
+	}
+
+	bs = bench.Filter(bs, q)
+	if *flagUnits != "" {
+		bs = bench.Project(bs, splitList(*flagUnits))
+	}
+	if err := bench.Fprint(os.Stdout, bs); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// flagQuery defines a -filter flag on fs and returns a function that
+// applies it to a set of benchmarks.
+func flagQuery(fs *flag.FlagSet) func([]*bench.Benchmark) []*bench.Benchmark {
+	expr := fs.String("filter", "", "consider only benchmarks matching `query`")
+	return func(bs []*bench.Benchmark) []*bench.Benchmark {
+		if *expr == "" {
+			return bs
+		}
+		q, err := bench.ParseQuery(*expr)
+		if err != nil {
+			fatalf("-filter: %v", err)
+		}
+		return bench.Filter(bs, q)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command gcbench analyzes the results of the gcbench benchmarks.
+//
+// Usage:
+//
+//	gcbench <command> [arguments]
+//
+// The commands are:
+//
+//	compare   compare two sets of benchmark results
+//	convert   convert benchmark results between text, JSON and CSV
+//	filter    select benchmark results matching a query
+//	regress   check benchmark results for regressions against a baseline
+//	report    render HTML reports from -json benchmark results
+//	table     tabulate a result unit by configuration values
+//
+// Use "gcbench <command> -h" for more information about a command.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	short string
+	run   func(args []string)
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"compare", "compare two sets of benchmark results", cmdCompare},
+		{"convert", "convert benchmark results between text, JSON and CSV", cmdConvert},
+		{"filter", "select benchmark results matching a query", cmdFilter},
+		{"regress", "check benchmark results for regressions against a baseline", cmdRegress},
+		{"report", "render HTML reports from -json benchmark results", cmdReport},
+		{"table", "tabulate a result unit by configuration values", cmdTable},
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: gcbench <command> [arguments]\n\nThe commands are:\n\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "\t%-9s %s\n", c.name, c.short)
+	}
+	fmt.Fprintf(os.Stderr, "\nUse \"gcbench <command> -h\" for more information about a command.\n")
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+	}
+	name := flag.Arg(0)
+	for _, c := range commands {
+		if c.name == name {
+			c.run(flag.Args()[1:])
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "gcbench: unknown command %q\n", name)
+	usage()
+}
+
+// newFlagSet returns a FlagSet for command name with a usage message
+// describing its arguments.
+func newFlagSet(name, args, desc string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gcbench %s %s\n\n%s\n", name, args, desc)
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	return fs
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "gcbench: "+format+"\n", args...)
+	os.Exit(1)
+}
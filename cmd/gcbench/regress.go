@@ -0,0 +1,249 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aclements/go-gcbench/bench"
+)
+
+func cmdRegress(args []string) {
+	fs := newFlagSet("regress", "[flags] baseline.txt new.txt", `Regress checks new benchmark results for regressions against baseline
+results and exits with status 1 if it finds any.
+
+A metric regresses if its change between the baseline and new
+results is statistically significant, is in the worse direction for
+its unit, and is larger than the tolerance for that metric. Metrics
+whose units have no known better direction are not checked. A metric
+that appears in only one of the baseline and new results also fails
+the check unless -allow-missing is given, and so does a metric with
+too few runs for any change to be significant at α, unless
+-allow-too-few is given.
+
+The -config file sets tolerances. Each line has the form
+
+	<unit> <tolerance>% [query]
+
+where <unit> is a result unit, which may contain "*" wildcards, and
+query optionally restricts the line to benchmarks matching a query.
+The first matching line applies. Blank lines and lines starting with
+"#" are ignored. For example:
+
+	95%ile-ns/markTerm  20%  name:LargeHeap
+	*-ns                10%
+	*                    5%
+
+`+queryHelp)
+	flagAllowMissing := fs.Bool("allow-missing", false, "don't fail on metrics missing from either set of results")
+	flagAllowTooFew := fs.Bool("allow-too-few", false, "don't fail on metrics with too few runs to test for a significant change")
+	flagAlpha := fs.Float64("alpha", 0.05, "consider changes significant if p < `α`")
+	flagConfig := fs.String("config", "", "read tolerances from `file`")
+	flagTolerance := fs.Float64("tolerance", 5, "default tolerance in `percent`")
+	flagVerbose := fs.Bool("v", false, "report all metrics, not just regressions")
+	filter := flagQuery(fs)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+	}
+
+	var rules []toleranceRule
+	if *flagConfig != "" {
+		var err error
+		rules, err = readToleranceRules(*flagConfig)
+		if err != nil {
+			fatalf("%v", err)
+		}
+	}
+	rules = append(rules, toleranceRule{unit: regexp.MustCompile(".*"), tolerance: *flagTolerance / 100})
+
+	old := filter(readBenchmarks(fs.Arg(0)))
+	new := filter(readBenchmarks(fs.Arg(1)))
+	if len(old) == 0 || len(new) == 0 {
+		fatalf("no benchmarks to compare")
+	}
+	// Rule queries match against a representative benchmark for
+	// each comparison key.
+	reps := make(map[string]*bench.Benchmark)
+	for _, b := range append(old, new...) {
+		if reps[b.Key()] == nil {
+			reps[b.Key()] = b
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	counts := make(map[string]int)
+	for _, c := range bench.Compare(old, new) {
+		var tolerance float64
+		for _, r := range rules {
+			if r.match(c.Unit, reps[c.Key]) {
+				tolerance = r.tolerance
+				break
+			}
+		}
+
+		status := judge(c, *flagAlpha, tolerance)
+		counts[status]++
+		if !failed(status, *flagAllowMissing, *flagAllowTooFew) && !*flagVerbose {
+			continue
+		}
+		delta := ""
+		if !math.IsNaN(c.Delta) {
+			delta = fmt.Sprintf("%+.2f%%", c.Delta*100)
+		}
+		p := ""
+		if !math.IsNaN(c.P) {
+			p = fmt.Sprintf("p=%.3f", c.P)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t(tolerance %g%%, %s n=%d+%d)\n", status, c.Key, c.Unit, delta, tolerance*100, p, len(c.Old.Values), len(c.New.Values))
+	}
+	if err := tw.Flush(); err != nil {
+		fatalf("%v", err)
+	}
+
+	var summary []string
+	for _, status := range statuses {
+		if counts[status] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	fmt.Println(strings.Join(summary, ", "))
+	if counts[statusTooFew] > 0 {
+		if *flagAllowTooFew {
+			fmt.Printf("warning: some metrics have too few runs to detect a significant change at α=%g\n", *flagAlpha)
+		} else {
+			fmt.Printf("some metrics have too few runs to detect a significant change at α=%g; collect more runs or use -allow-too-few\n", *flagAlpha)
+		}
+	}
+	for status, n := range counts {
+		if n > 0 && failed(status, *flagAllowMissing, *flagAllowTooFew) {
+			os.Exit(1)
+		}
+	}
+}
+
+// Statuses of a metric, in the order they're summarized.
+const (
+	statusRegression  = "REGRESSION"
+	statusTolerated   = "within-tolerance"
+	statusImprovement = "improvement"
+	statusUnchanged   = "unchanged"
+	statusTooFew      = "too-few-runs"
+	statusUnknown     = "unknown-direction"
+	statusMissing     = "missing"
+)
+
+var statuses = []string{statusRegression, statusTolerated, statusImprovement, statusUnchanged, statusTooFew, statusUnknown, statusMissing}
+
+// judge returns the status of comparison c.
+func judge(c *bench.Comparison, alpha, tolerance float64) string {
+	switch {
+	case len(c.Old.Values) == 0 || len(c.New.Values) == 0:
+		return statusMissing
+	case c.Info.Better == bench.DirectionUnknown:
+		return statusUnknown
+	}
+	switch c.Change(alpha) {
+	case 1:
+		return statusImprovement
+	case -1:
+		if math.Abs(c.Delta) > tolerance {
+			return statusRegression
+		}
+		return statusTolerated
+	}
+	if minPValue(len(c.Old.Values), len(c.New.Values)) >= alpha {
+		return statusTooFew
+	}
+	return statusUnchanged
+}
+
+// failed returns whether a metric with the given status fails the
+// regression check.
+func failed(status string, allowMissing, allowTooFew bool) bool {
+	switch status {
+	case statusRegression:
+		return true
+	case statusMissing:
+		return !allowMissing
+	case statusTooFew:
+		return !allowTooFew
+	}
+	return false
+}
+
+// minPValue returns the smallest p-value a two-sided Mann-Whitney U
+// test can produce for samples of size n1 and n2 without ties.
+func minPValue(n1, n2 int) float64 {
+	// The most extreme arrangements are the two where the samples
+	// don't interleave, out of C(n1+n2, n1) arrangements.
+	combinations := 1.0
+	for i := 1; i <= n1; i++ {
+		combinations *= float64(n2+i) / float64(i)
+	}
+	return 2 / combinations
+}
+
+// A toleranceRule is a line of a regress tolerance config file.
+type toleranceRule struct {
+	unit      *regexp.Regexp
+	tolerance float64 // Fraction, not percent
+	query     *bench.Query
+}
+
+func (r *toleranceRule) match(unit string, b *bench.Benchmark) bool {
+	return r.unit.MatchString(unit) && (r.query == nil || r.query.Match(b))
+}
+
+// readToleranceRules reads a regress tolerance config file.
+func readToleranceRules(path string) ([]toleranceRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseToleranceRules(f, path)
+}
+
+// parseToleranceRules parses a regress tolerance config file from r.
+// path is used only in error messages.
+func parseToleranceRules(r io.Reader, path string) ([]toleranceRule, error) {
+	var rules []toleranceRule
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || !strings.HasSuffix(fields[1], "%") {
+			return nil, fmt.Errorf("%s:%d: expected <unit> <tolerance>%% [query]", path, lineNum)
+		}
+		tol, err := strconv.ParseFloat(strings.TrimSuffix(fields[1], "%"), 64)
+		if err != nil || tol < 0 {
+			return nil, fmt.Errorf("%s:%d: bad tolerance %q", path, lineNum, fields[1])
+		}
+		re := "^" + strings.Replace(regexp.QuoteMeta(fields[0]), `\*`, ".*", -1) + "$"
+		rule := toleranceRule{unit: regexp.MustCompile(re), tolerance: tol / 100}
+		if len(fields) > 2 {
+			rule.query, err = bench.ParseQuery(strings.Join(fields[2:], " "))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, lineNum, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
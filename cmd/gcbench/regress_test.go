@@ -0,0 +1,136 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aclements/go-gcbench/bench"
+)
+
+func TestJudge(t *testing.T) {
+	lower := bench.Unit{Name: "ns/op", Better: bench.LowerIsBetter}
+	comparison := func(info bench.Unit, old, new []float64) *bench.Comparison {
+		c := &bench.Comparison{Unit: info.Name, Info: info, Old: bench.NewSample(old), New: bench.NewSample(new)}
+		c.Delta = c.New.Mean/c.Old.Mean - 1
+		// The p-value of any two non-interleaved samples of 5.
+		c.P = 2.0 / 252
+		if len(old) < 5 || len(new) < 5 {
+			c.P = 0.1
+		}
+		return c
+	}
+	fives := func(v float64) []float64 { return []float64{v, v, v, v, v} }
+
+	for _, test := range []struct {
+		name     string
+		c        *bench.Comparison
+		want     string
+		failed   bool
+		failedOK bool // failed with -allow-missing -allow-too-few
+	}{
+		{"regression", comparison(lower, fives(100), fives(110)), statusRegression, true, true},
+		{"tolerated", comparison(lower, fives(100), fives(104)), statusTolerated, false, false},
+		{"improvement", comparison(lower, fives(100), fives(50)), statusImprovement, false, false},
+		{"higher is better", comparison(bench.Unit{Name: "MB/s", Better: bench.HigherIsBetter}, fives(100), fives(50)), statusRegression, true, true},
+		{"too few", comparison(lower, []float64{100, 100, 100}, []float64{200, 200, 200}), statusTooFew, true, false},
+		// With one run each, no p-value is significant, so
+		// even a large regression can't be detected.
+		{"one run", comparison(lower, []float64{100}, []float64{150}), statusTooFew, true, false},
+		{"unknown direction", comparison(bench.Unit{Name: "widgets"}, fives(100), fives(200)), statusUnknown, false, false},
+		{"missing new", comparison(lower, fives(100), nil), statusMissing, true, false},
+		{"missing old", comparison(lower, nil, fives(100)), statusMissing, true, false},
+	} {
+		got := judge(test.c, 0.05, 0.05)
+		if got != test.want {
+			t.Errorf("%s: judge = %s, want %s", test.name, got, test.want)
+		}
+		if f := failed(got, false, false); f != test.failed {
+			t.Errorf("%s: failed = %v, want %v", test.name, f, test.failed)
+		}
+		if f := failed(got, true, true); f != test.failedOK {
+			t.Errorf("%s: failed with -allow-missing -allow-too-few = %v, want %v", test.name, f, test.failedOK)
+		}
+	}
+
+	// An insignificant change with enough runs is unchanged.
+	c := comparison(lower, fives(100), fives(200))
+	c.P = 0.5
+	if got := judge(c, 0.05, 0.05); got != statusUnchanged {
+		t.Errorf("insignificant change: judge = %s, want %s", got, statusUnchanged)
+	}
+}
+
+func TestMinPValue(t *testing.T) {
+	for _, test := range []struct {
+		n1, n2 int
+		want   float64
+	}{
+		{3, 3, 0.1},
+		{1, 1, 1},
+		{5, 5, 2.0 / 252},
+	} {
+		if got := minPValue(test.n1, test.n2); got-test.want > 1e-12 || test.want-got > 1e-12 {
+			t.Errorf("minPValue(%d, %d) = %v, want %v", test.n1, test.n2, got, test.want)
+		}
+	}
+}
+
+func TestParseToleranceRules(t *testing.T) {
+	const config = `# Tolerances
+95%ile-ns/markTerm  20%  name:LargeHeap retain>=1GB
+
+*-ns                10%
+*                    5.5%
+`
+	rules, err := parseToleranceRules(strings.NewReader(config), "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := bench.Parse(strings.NewReader(`BenchmarkLargeHeap/retain:1GB 1 1 ns/op
+BenchmarkLargeHeap/retain:64MB 1 1 ns/op
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		unit string
+		b    *bench.Benchmark
+		want float64
+	}{
+		{"95%ile-ns/markTerm", bs[0], 0.2},
+		{"95%ile-ns/markTerm", bs[1], 0.055},
+		{"P99-latency-ns", bs[1], 0.1},
+		// "*" matches the whole unit, not a substring.
+		{"P99-latency-ns/op", bs[1], 0.055},
+		{"ns/op", bs[0], 0.055},
+	} {
+		got := -1.0
+		for _, r := range rules {
+			if r.match(test.unit, test.b) {
+				got = r.tolerance
+				break
+			}
+		}
+		if got != test.want {
+			t.Errorf("tolerance for %s in %s = %v, want %v", test.unit, test.b.Key(), got, test.want)
+		}
+	}
+
+	for _, bad := range []string{
+		"ns/op",
+		"ns/op 5",
+		"ns/op x%",
+		"ns/op -1%",
+		"ns/op 5% name<X",
+	} {
+		if _, err := parseToleranceRules(strings.NewReader(bad), "config"); err == nil {
+			t.Errorf("parse %q: want error", bad)
+		} else if !strings.HasPrefix(err.Error(), "config:1: ") {
+			t.Errorf("parse %q: error %q does not give the line", bad, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aclements/go-gcbench/gcbench"
+)
+
+func cmdReport(args []string) {
+	fs := newFlagSet("report", "[-o dir] results.json...", `Report renders an HTML page for each benchmark run recorded in the
+given results files, which are written by the -json flag of the
+benchmarks. Each page is self-contained.`)
+	flagOut := fs.String("o", ".", "write reports to `dir`")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+	}
+
+	if err := os.MkdirAll(*flagOut, 0777); err != nil {
+		fatalf("%v", err)
+	}
+	used := map[string]bool{}
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		results, err := gcbench.ReadRunResults(f)
+		f.Close()
+		if err != nil {
+			fatalf("reading %s: %v", path, err)
+		}
+
+		for _, r := range results {
+			// Give repeated runs of the same benchmark
+			// distinct names.
+			base := reportName(r.Name)
+			name := base + ".html"
+			for i := 2; used[name]; i++ {
+				name = fmt.Sprintf("%s-%d.html", base, i)
+			}
+			used[name] = true
+
+			out, err := os.Create(filepath.Join(*flagOut, name))
+			if err != nil {
+				fatalf("%v", err)
+			}
+			err = gcbench.WriteHTMLReport(out, r)
+			if err1 := out.Close(); err == nil {
+				err = err1
+			}
+			if err != nil {
+				fatalf("writing %s: %v", out.Name(), err)
+			}
+			fmt.Println(out.Name())
+		}
+	}
+}
+
+// reportName returns a file name for a benchmark's report.
+func reportName(benchName string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, strings.TrimPrefix(benchName, "Benchmark"))
+}
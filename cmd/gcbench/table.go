@@ -0,0 +1,66 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/aclements/go-gcbench/bench"
+)
+
+func cmdTable(args []string) {
+	fs := newFlagSet("table", "-unit unit [-rows keys] [-cols keys] [flags] files...", `Table prints a pivot table of one result unit from the given benchmark
+results files. Rows and columns are grouped by the values of
+comma-separated lists of configuration keys, where the key "name"
+refers to the benchmark name. Repeated runs in the same cell are
+combined using the -agg function.`)
+	flagUnit := fs.String("unit", "", "tabulate results in `unit`")
+	flagRows := fs.String("rows", "name", "group rows by comma-separated config `keys`")
+	flagCols := fs.String("cols", "", "group columns by comma-separated config `keys`")
+	flagAgg := fs.String("agg", "median", "combine repeated runs using `func` (median, mean, min, or max)")
+	flagFormat := fs.String("format", "text", "output `format` (text, csv, or markdown)")
+	filter := flagQuery(fs)
+	fs.Parse(args)
+	if fs.NArg() == 0 || *flagUnit == "" {
+		fs.Usage()
+	}
+	agg, ok := bench.Aggregators[*flagAgg]
+	if !ok {
+		fatalf("unknown aggregation function %q", *flagAgg)
+	}
+
+	var bs []*bench.Benchmark
+	for _, path := range fs.Args() {
+		bs = append(bs, readBenchmarks(path)...)
+	}
+	bs = filter(bs)
+	bench.ParseValues(bs, nil)
+
+	t := bench.NewTable(bs, splitList(*flagRows), splitList(*flagCols), *flagUnit, agg)
+	var err error
+	switch *flagFormat {
+	case "text":
+		err = t.Fprint(os.Stdout)
+	case "csv":
+		err = t.FprintCSV(os.Stdout)
+	case "markdown":
+		err = t.FprintMarkdown(os.Stdout)
+	default:
+		fatalf("unknown format %q", *flagFormat)
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// splitList splits a comma-separated list, returning nil for an
+// empty list.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -4,16 +4,36 @@
 
 package gcbench
 
-import "time"
+import (
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
 
 // A Churner churns the heap to cause GCs at some rate.
+//
+// When a benchmark's main function returns, the harness reports the
+// combined Stats of every Churner it started as the metrics churn-B,
+// churn-objects, churn-missed-ticks, churn-B/sec, and
+// churn-achieved-ratio, and any AllocLatency as churn-alloc. A main
+// function that calls os.Exit skips this.
 type Churner struct {
 	// BallastBytes is the minimum bytes to retain in the heap.
 	//
-	// This is implemented as a simple []byte allocation. A caller
-	// may create their own ballast and set this to 0.
+	// This is implemented as a simple []byte allocation, which the
+	// garbage collector doesn't need to scan. To retain a ballast
+	// with pointers, set Ballast and set this to 0.
 	BallastBytes uint64
 
+	// Ballast, if non-nil, is retained while the Churner runs.
+	// Use heapgen.Generate to create a ballast of a given heap
+	// shape.
+	Ballast interface{}
+
 	// BytesPerSec is how many bytes of garbage to allocate per
 	// second.
 	//
@@ -21,12 +41,100 @@ type Churner struct {
 	// one GC per second.
 	BytesPerSec uint64
 
+	// Schedule, if non-nil, varies the allocation rate over time
+	// and overrides BytesPerSec. The Churner reports a phase with
+	// ReportPhase at the beginning of each segment, so the
+	// harness can compute GC metrics for each segment.
+	Schedule RateSchedule
+
+	// Profile describes the objects to allocate. If Profile is
+	// nil, the Churner allocates a single []byte of a tenth of the
+	// rate ten times a second.
+	Profile *AllocProfile
+
+	// Goroutines is the number of goroutines to divide the
+	// allocation between if Profile is non-nil. If Goroutines is
+	// 0, it is 1.
+	Goroutines int
+
+	// AllocLatency, if non-nil, records how long each allocation
+	// takes. Slow allocations usually mean the Churner was
+	// stalled by a GC assist. The zero LatencyDist can't resolve
+	// latencies below 100ns, so use NewLatencyDist to measure
+	// small allocations.
+	AllocLatency *LatencyDist
+
 	ballast []byte
 
+	// bytes and objects count allocations over all runs of the
+	// Churner, and missed is the nanoseconds allocation has
+	// fallen behind, as counted by MissedTicks. They are
+	// accessed atomically.
+	bytes, objects, missed uint64
+
+	// ran and requested are the duration and requested bytes of
+	// all completed runs of the Churner.
+	ran       time.Duration
+	requested float64
+
+	start         time.Time
+	registered    bool
 	ticker        *time.Ticker
 	stop, stopped chan struct{}
 }
 
+// ChurnerStats are the statistics of a Churner over all the times it
+// has run.
+type ChurnerStats struct {
+	// Bytes and Objects are the bytes and number of objects the
+	// Churner has allocated.
+	Bytes, Objects uint64
+
+	// MissedTicks is how far the Churner has fallen behind its
+	// rate, in units of churnMaxWait (10ms). Each time allocation
+	// falls more than churnMaxWait behind schedule, how far behind
+	// it falls counts, whether the Churner later catches up or
+	// skips the allocation. With several goroutines, each
+	// goroutine's lag counts in proportion to its share of the
+	// rate.
+	MissedTicks uint64
+
+	// Duration is the total time the Churner has run.
+	Duration time.Duration
+
+	// RequestedBytes is the bytes the Churner would have
+	// allocated if it had kept up with its rate.
+	RequestedBytes float64
+}
+
+// churners is every Churner that has been started, so the harness can
+// report their statistics when the benchmark finishes.
+var churners struct {
+	sync.Mutex
+	list []*Churner
+}
+
+// An AllocProfile describes the objects a Churner allocates.
+type AllocProfile struct {
+	// Sizes and Weights give the distribution of object sizes in
+	// bytes: each object has size Sizes[i] with probability
+	// proportional to Weights[i]. If Weights is nil, all sizes
+	// are equally likely.
+	Sizes   []int
+	Weights []float64
+
+	// PointerFraction is the fraction of objects that contain
+	// pointers. Every word of such an object is a pointer.
+	PointerFraction float64
+
+	// Burst is the number of objects allocated at a time. The
+	// pointers in each object of a burst point to the previous
+	// object, and each goroutine keeps its latest burst reachable
+	// until it allocates the next one, so the garbage collector
+	// scans some of the garbage. If Burst is 0, it is 1.
+	Burst int
+}
+
 var churnSink interface{}
 
 func (c *Churner) Start() {
@@ -37,29 +145,77 @@ func (c *Churner) Start() {
 	}
 	stop, stopped := make(chan struct{}), make(chan struct{})
 	c.stop, c.stopped = stop, stopped
+	c.start = time.Now()
+
+	churners.Lock()
+	if !c.registered {
+		c.registered = true
+		churners.list = append(churners.list, c)
+	}
+	churners.Unlock()
 
 	if c.ballast == nil && c.BallastBytes > 0 {
 		c.ballast = make([]byte, c.BallastBytes)
 	}
-	if c.ticker == nil {
-		c.ticker = time.NewTicker(time.Second / allocsPerSec)
+
+	var wg sync.WaitGroup
+	if c.Schedule != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.reportPhases(stop)
+		}()
+	}
+	if c.Profile != nil {
+		c.startProfile(stop, &wg)
+	} else {
+		if c.ticker == nil {
+			c.ticker = time.NewTicker(time.Second / allocsPerSec)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			const interval = time.Second / allocsPerSec
+			var last time.Time
+			for {
+				var now time.Time
+				select {
+				case <-stop:
+					return
+				case now = <-c.ticker.C:
+				}
+				// The ticker drops ticks if this goroutine
+				// falls behind, so the allocations of late
+				// ticks are skipped. Count how late the
+				// delivered ticks are.
+				if !last.IsZero() {
+					if late := now.Sub(last) - interval; late > churnMaxWait {
+						atomic.AddUint64(&c.missed, uint64(late))
+					}
+				}
+				last = now
+				bytes := uint64(c.rate(time.Since(c.start)) / allocsPerSec)
+				if c.AllocLatency != nil {
+					t0 := time.Now()
+					churnSink = make([]byte, bytes)
+					c.AllocLatency.Add(time.Since(t0))
+				} else {
+					churnSink = make([]byte, bytes)
+				}
+				atomic.AddUint64(&c.bytes, bytes)
+				atomic.AddUint64(&c.objects, 1)
+			}
+		}()
 	}
 
 	go func() {
-	loop:
-		for {
-			select {
-			case <-stop:
-				break loop
-			case <-c.ticker.C:
-			}
-			churnSink = make([]byte, c.BytesPerSec/allocsPerSec)
-		}
+		wg.Wait()
 		close(stopped)
 		// Keep the ballast alive.
 		if c.ballast != nil {
 			c.ballast[0] = 0
 		}
+		runtime.KeepAlive(c.Ballast)
 	}()
 }
 
@@ -67,4 +223,285 @@ func (c *Churner) Stop() {
 	close(c.stop)
 	<-c.stopped
 	c.stop, c.stopped = nil, nil
+	d := time.Since(c.start)
+	c.ran += d
+	c.requested += c.requestedBytes(d)
+}
+
+// Stats returns the statistics of c over all the times it has run,
+// including the current run if c is running.
+func (c *Churner) Stats() ChurnerStats {
+	s := ChurnerStats{
+		Bytes:          atomic.LoadUint64(&c.bytes),
+		Objects:        atomic.LoadUint64(&c.objects),
+		MissedTicks:    atomic.LoadUint64(&c.missed) / uint64(churnMaxWait),
+		Duration:       c.ran,
+		RequestedBytes: c.requested,
+	}
+	if c.stop != nil {
+		d := time.Since(c.start)
+		s.Duration += d
+		s.RequestedBytes += c.requestedBytes(d)
+	}
+	return s
+}
+
+// AchievedRate returns the bytes per second the Churner actually
+// allocated over all the times it has run, for comparison with
+// BytesPerSec or the rates of Schedule. A Churner falls short if
+// allocation is slow, for example because of GC assists.
+func (c *Churner) AchievedRate() float64 {
+	s := c.Stats()
+	return float64(s.Bytes) / s.Duration.Seconds()
+}
+
+// requestedBytes returns the bytes c should allocate in the first d
+// of a run.
+func (c *Churner) requestedBytes(d time.Duration) float64 {
+	if c.Schedule == nil {
+		return float64(c.BytesPerSec) * d.Seconds()
+	}
+	const step = time.Millisecond
+	var bytes float64
+	for t := time.Duration(0); t < d; t += step {
+		dt := step
+		if d-t < dt {
+			dt = d - t
+		}
+		bytes += c.Schedule.Rate(t) * dt.Seconds()
+	}
+	return bytes
+}
+
+// reportChurners reports the combined statistics of every Churner
+// that has been started using ReportExtra, and their allocation
+// latencies using ReportLatency.
+func reportChurners() {
+	churners.Lock()
+	defer churners.Unlock()
+	if len(churners.list) == 0 {
+		return
+	}
+	var total ChurnerStats
+	var rate float64
+	reported := make(map[*LatencyDist]bool)
+	for _, c := range churners.list {
+		s := c.Stats()
+		total.Bytes += s.Bytes
+		total.Objects += s.Objects
+		total.MissedTicks += s.MissedTicks
+		total.RequestedBytes += s.RequestedBytes
+		if s.Duration > 0 {
+			rate += float64(s.Bytes) / s.Duration.Seconds()
+		}
+		if d := c.AllocLatency; d != nil && !reported[d] {
+			reported[d] = true
+			ReportLatency("churn-alloc", d)
+		}
+	}
+	ReportExtra("churn-B", float64(total.Bytes))
+	ReportExtra("churn-objects", float64(total.Objects))
+	ReportExtra("churn-missed-ticks", float64(total.MissedTicks))
+	ReportExtra("churn-B/sec", rate)
+	if total.RequestedBytes > 0 {
+		ReportExtra("churn-achieved-ratio", float64(total.Bytes)/total.RequestedBytes)
+	}
+}
+
+// rate returns the requested allocation rate in bytes per second at
+// time t after Start.
+func (c *Churner) rate(t time.Duration) float64 {
+	if c.Schedule != nil {
+		return c.Schedule.Rate(t)
+	}
+	return float64(c.BytesPerSec)
+}
+
+// reportPhases reports a phase at the beginning of each segment of
+// c.Schedule until stop is closed.
+func (c *Churner) reportPhases(stop chan struct{}) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+		seg, into := c.Schedule.segment(time.Since(c.start))
+		// Report the segment only near its beginning. A timer
+		// that fires a little early finds itself at the end of
+		// the previous segment, and waits for the rest of it.
+		if into < c.Schedule[seg].Duration/2 {
+			ReportPhase(c.Schedule[seg].Name)
+		}
+		timer.Reset(c.Schedule[seg].Duration - into)
+	}
+}
+
+// churnMaxWait is the longest a Churner with a Profile waits between
+// checking its rate, and the unit of ChurnerStats.MissedTicks.
+const churnMaxWait = 10 * time.Millisecond
+
+// A lagCounter counts how far allocation falls behind schedule for
+// ChurnerStats.MissedTicks. Reset it to the zero lagCounter when
+// allocation catches up.
+type lagCounter struct {
+	max time.Duration // Greatest lag since last caught up
+}
+
+// behind records that allocation is lag behind schedule and returns
+// how much of lag hasn't already been counted. Lags of up to
+// churnMaxWait aren't counted.
+func (l *lagCounter) behind(lag time.Duration) time.Duration {
+	if lag <= churnMaxWait || lag <= l.max {
+		return 0
+	}
+	d := lag - l.max
+	l.max = lag
+	return d
+}
+
+// startProfile starts goroutines in wg that allocate according to
+// c.Profile until stop is closed.
+func (c *Churner) startProfile(stop chan struct{}, wg *sync.WaitGroup) {
+	p := c.Profile
+	if len(p.Sizes) == 0 || (p.Weights != nil && len(p.Weights) != len(p.Sizes)) {
+		panic("AllocProfile needs Sizes and matching Weights")
+	}
+	// Compute the cumulative distribution of sizes and the mean
+	// size.
+	cdf := make([]float64, len(p.Sizes))
+	var total, mean float64
+	for i, size := range p.Sizes {
+		w := 1.0
+		if p.Weights != nil {
+			w = p.Weights[i]
+		}
+		total += w
+		cdf[i] = total
+		mean += w * float64(size)
+	}
+	mean /= total
+
+	burst := p.Burst
+	if burst == 0 {
+		burst = 1
+	}
+	gs := c.Goroutines
+	if gs == 0 {
+		gs = 1
+	}
+	burstBytes := mean * float64(burst)
+
+	// sinks keeps each goroutine's latest burst reachable.
+	sinks := make([]interface{}, gs)
+	wg.Add(gs)
+	for g := 0; g < gs; g++ {
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			sizeOf := func() int {
+				i := sort.SearchFloat64s(cdf, rng.Float64()*total)
+				if i == len(cdf) {
+					i--
+				}
+				return p.Sizes[i]
+			}
+			timer := time.NewTimer(0)
+			defer timer.Stop()
+			// due is the bytes this goroutine should have
+			// allocated by last but hasn't.
+			var due float64
+			var last time.Duration
+			var lag lagCounter
+			for {
+				// Allocate a burst whenever one is due, so
+				// the rate is smooth and a late goroutine
+				// catches up.
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				now := time.Since(c.start)
+				rate := c.rate(now) / float64(gs)
+				due += rate * (now - last).Seconds()
+				last = now
+				if due < burstBytes {
+					lag = lagCounter{}
+					// Wake up when the next burst is due
+					// at the current rate, but at least
+					// every churnMaxWait to follow changes
+					// in the rate.
+					wait := churnMaxWait
+					if rate > 0 {
+						if d := time.Duration((burstBytes - due) / rate * float64(time.Second)); d < wait {
+							wait = d
+						}
+					}
+					timer.Reset(wait)
+					select {
+					case <-stop:
+						return
+					case <-timer.C:
+					}
+					continue
+				}
+				// This goroutine is behind by the time it
+				// takes to allocate the bytes due after
+				// this burst.
+				if rate > 0 {
+					late := time.Duration((due - burstBytes) / rate * float64(time.Second))
+					if d := lag.behind(late); d > 0 {
+						atomic.AddUint64(&c.missed, uint64(d)/uint64(gs))
+					}
+				}
+				var n int
+				sinks[g], n = allocBurst(burst, sizeOf, p.PointerFraction, rng, c.AllocLatency)
+				due -= float64(n)
+				atomic.AddUint64(&c.bytes, uint64(n))
+				atomic.AddUint64(&c.objects, uint64(burst))
+			}
+		}(g)
+	}
+}
+
+// allocBurst allocates n objects with sizes from sizeOf, a fraction
+// ptrFrac of which contain pointers, and returns the last object and
+// the total bytes allocated. If lat is non-nil, it records the time
+// of each allocation in lat.
+func allocBurst(n int, sizeOf func() int, ptrFrac float64, rng *rand.Rand, lat *LatencyDist) (interface{}, int) {
+	const ptrSize = int(unsafe.Sizeof(uintptr(0)))
+	var last interface{}
+	var lastPtr unsafe.Pointer
+	bytes := 0
+	for i := 0; i < n; i++ {
+		size := sizeOf()
+		bytes += size
+		var t0 time.Time
+		if lat != nil {
+			t0 = time.Now()
+		}
+		if size >= ptrSize && rng.Float64() < ptrFrac {
+			obj := make([]unsafe.Pointer, size/ptrSize)
+			if lat != nil {
+				lat.Add(time.Since(t0))
+			}
+			for j := range obj {
+				obj[j] = lastPtr
+			}
+			last, lastPtr = obj, unsafe.Pointer(&obj[0])
+		} else {
+			obj := make([]byte, size)
+			if lat != nil {
+				lat.Add(time.Since(t0))
+			}
+			last = obj
+			if size > 0 {
+				lastPtr = unsafe.Pointer(&obj[0])
+			}
+		}
+	}
+	return last, bytes
 }
@@ -0,0 +1,82 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcbench
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChurnerProfile(t *testing.T) {
+	const rate = 64 << 20
+	c := Churner{
+		BytesPerSec: rate,
+		Profile: &AllocProfile{
+			Sizes:           []int{16, 128, 4096},
+			Weights:         []float64{8, 4, 1},
+			PointerFraction: 0.5,
+			Burst:           16,
+		},
+		Goroutines:   4,
+		AllocLatency: NewLatencyDist(time.Nanosecond, time.Minute, 0.01),
+	}
+	// Each goroutine allocates at most a burst ahead of its share
+	// of the rate. How far behind it falls depends on the machine,
+	// so the test doesn't check that.
+	const maxAhead = 4 * 16 * 4096
+
+	c.Start()
+	time.Sleep(200 * time.Millisecond)
+	c.Stop()
+	s := c.Stats()
+	if s.Bytes == 0 || float64(s.Bytes) > s.RequestedBytes+maxAhead {
+		t.Errorf("allocated %d bytes, want at most %.0f", s.Bytes, s.RequestedBytes+maxAhead)
+	}
+	if s.Objects == 0 || s.Objects%16 != 0 {
+		t.Errorf("allocated %d objects, want a positive multiple of the burst size", s.Objects)
+	}
+	if c.AllocLatency.N != int64(s.Objects) {
+		t.Errorf("recorded %d allocation latencies for %d objects", c.AllocLatency.N, s.Objects)
+	}
+
+	// A stopped Churner can be restarted, and its statistics
+	// accumulate.
+	c.Start()
+	time.Sleep(50 * time.Millisecond)
+	c.Stop()
+	s2 := c.Stats()
+	if s2.Bytes <= s.Bytes || s2.Duration < s.Duration+50*time.Millisecond {
+		t.Errorf("statistics did not accumulate: %+v then %+v", s, s2)
+	}
+	if float64(s2.Bytes) > s2.RequestedBytes+2*maxAhead {
+		t.Errorf("allocated %d bytes, want at most %.0f", s2.Bytes, s2.RequestedBytes+2*maxAhead)
+	}
+}
+
+func TestLagCounter(t *testing.T) {
+	var l lagCounter
+	for _, test := range []struct {
+		lag, want time.Duration
+	}{
+		// Lags up to churnMaxWait don't count.
+		{5 * time.Millisecond, 0},
+		{churnMaxWait, 0},
+		// Falling further behind counts the whole lag, then
+		// only what's new.
+		{15 * time.Millisecond, 15 * time.Millisecond},
+		{35 * time.Millisecond, 20 * time.Millisecond},
+		// Catching up part way doesn't count again.
+		{20 * time.Millisecond, 0},
+		{40 * time.Millisecond, 5 * time.Millisecond},
+	} {
+		if got := l.behind(test.lag); got != test.want {
+			t.Errorf("behind(%v) = %v, want %v", test.lag, got, test.want)
+		}
+	}
+	l = lagCounter{}
+	if got := l.behind(20 * time.Millisecond); got != 20*time.Millisecond {
+		t.Errorf("after catching up, behind(20ms) = %v, want 20ms", got)
+	}
+}
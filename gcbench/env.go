@@ -0,0 +1,130 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcbench
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aclements/go-gcbench/bench"
+)
+
+var printEnvOnce sync.Once
+
+// printEnv prints a configuration block describing the machine and
+// Go environment the benchmarks are running in. These lines are in
+// the standard "key: value" configuration format, so bench.Parse
+// will attach them to every following benchmark result. It also
+// prints unit metadata lines describing the standard metrics.
+func printEnv() {
+	for _, c := range envConfig() {
+		fmt.Printf("%s: %s\n", c.k, c.v)
+	}
+	for _, m := range metrics {
+		fmt.Println(bench.LookupUnit(m.Label))
+	}
+	fmt.Printf("\n")
+}
+
+// envConfig returns the environment configuration of this process.
+// Values that can't be determined on this system are omitted.
+func envConfig() []config {
+	cfg := []config{
+		{"goos", runtime.GOOS},
+		{"goarch", runtime.GOARCH},
+		{"goversion", runtime.Version()},
+	}
+	if cpu := cpuModel(); cpu != "" {
+		cfg = append(cfg, config{"cpu", cpu})
+	}
+	cfg = append(cfg, config{"ncpu", fmt.Sprint(runtime.NumCPU())})
+	if kernel := kernelVersion(); kernel != "" {
+		cfg = append(cfg, config{"kernel", kernel})
+	}
+	if mem := totalMemory(); mem != 0 {
+		// Bytes.String is subject to rounding error for
+		// non-round sizes, so print whole MiB.
+		cfg = append(cfg, config{"mem", fmt.Sprintf("%dMiB", mem/MiB)})
+	}
+
+	// Report the GC settings the benchmark process will inherit.
+	gogc := os.Getenv("GOGC")
+	if gogc == "" {
+		gogc = "100"
+	}
+	cfg = append(cfg, config{"gogc", gogc})
+	gomemlimit := os.Getenv("GOMEMLIMIT")
+	if gomemlimit == "" {
+		gomemlimit = "off"
+	}
+	cfg = append(cfg, config{"gomemlimit", gomemlimit})
+	if godebug := os.Getenv("GODEBUG"); godebug != "" {
+		cfg = append(cfg, config{"godebug", godebug})
+	}
+	return cfg
+}
+
+// cpuModel returns the CPU model name from /proc/cpuinfo, or "" if
+// it isn't available.
+func cpuModel() string {
+	data, err := ioutil.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "model name") {
+			continue
+		}
+		if i := strings.Index(line, ":"); i >= 0 {
+			return strings.TrimSpace(line[i+1:])
+		}
+	}
+	return ""
+}
+
+// kernelVersion returns the kernel name and release, or "" if it
+// isn't available.
+func kernelVersion() string {
+	ostype, err := ioutil.ReadFile("/proc/sys/kernel/ostype")
+	if err != nil {
+		return ""
+	}
+	release, err := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(ostype)) + " " + strings.TrimSpace(string(release))
+}
+
+// totalMemory returns the total physical memory of the system from
+// /proc/meminfo, or 0 if it isn't available.
+func totalMemory() Bytes {
+	data, err := ioutil.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fs := strings.Fields(scanner.Text())
+		if len(fs) != 3 || fs[0] != "MemTotal:" || fs[2] != "kB" {
+			continue
+		}
+		kb, err := strconv.ParseInt(fs[1], 10, 64)
+		if err != nil {
+			return 0
+		}
+		return Bytes(kb) * KiB
+	}
+	return 0
+}
@@ -0,0 +1,19 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapgen
+
+// MakeBlobs constructs count pointer-free byte slices of size bytes
+// each. Blobs occupy heap but the garbage collector never scans them,
+// so they contribute to heap size without mark work.
+func MakeBlobs(count, size int) interface{} {
+	if count <= 0 || size <= 0 {
+		panic("bad blob count or size")
+	}
+	blobs := make([][]byte, count)
+	for i := range blobs {
+		blobs[i] = make([]byte, size)
+	}
+	return blobs
+}
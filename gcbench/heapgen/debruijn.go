@@ -4,6 +4,8 @@
 
 package heapgen
 
+import "math"
+
 type node2 struct {
 	ptrs [2]*node2
 }
@@ -13,7 +15,6 @@ type node2 struct {
 // out-edges and 2 in-edges and the diameter of the graph is power.
 func MakeDeBruijn2(power int) interface{} {
 	const degree = 2
-	//numNodes := int(math.Pow(degree, float64(power))) // General case
 	numNodes := 1 << uint(power)
 	if power < 0 || numNodes <= 0 {
 		panic("bad power")
@@ -39,3 +40,37 @@ func MakeDeBruijn2(power int) interface{} {
 	// reachable from any node.
 	return graph[0]
 }
+
+type graphNode struct {
+	edges []*graphNode
+}
+
+// MakeDeBruijn constructs a de Bruijn graph of objects of the given
+// degree with exactly degree**power nodes. Each node in the graph has
+// exactly degree out-edges and degree in-edges and the diameter of the
+// graph is power. Unlike MakeDeBruijn2, each node's out-edges are in
+// a separate object from the node.
+func MakeDeBruijn(degree, power int) interface{} {
+	if degree < 1 || power < 0 {
+		panic("bad degree or power")
+	}
+	numNodes := 1
+	for i := 0; i < power; i++ {
+		if numNodes > math.MaxInt32/degree {
+			panic("too many nodes")
+		}
+		numNodes *= degree
+	}
+	graph := make([]*graphNode, numNodes)
+	for i := range graph {
+		graph[i] = &graphNode{make([]*graphNode, degree)}
+	}
+	for i, node := range graph {
+		// As in MakeDeBruijn2.
+		next := i * degree % numNodes
+		for digit := 0; digit < degree; digit++ {
+			node.edges[digit] = graph[next+digit]
+		}
+	}
+	return graph[0]
+}
@@ -0,0 +1,23 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapgen
+
+type leaf struct {
+	a, b int
+}
+
+// MakeFanout constructs a slice of width pointers, each to a separate
+// small pointer-free object. The slice is a single large object whose
+// scan discovers all of the leaves at once.
+func MakeFanout(width int) interface{} {
+	if width <= 0 {
+		panic("bad width")
+	}
+	s := make([]*leaf, width)
+	for i := range s {
+		s[i] = &leaf{i, i}
+	}
+	return s
+}
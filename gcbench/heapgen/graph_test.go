@@ -0,0 +1,80 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapgen
+
+import "testing"
+
+func TestDeBruijn(t *testing.T) {
+	root := MakeDeBruijn(3, 4).(*graphNode)
+	// Every node is reachable from the root within power hops and
+	// every node has degree in-edges.
+	depth := map[*graphNode]int{root: 0}
+	in := map[*graphNode]int{}
+	queue := []*graphNode{root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if len(n.edges) != 3 {
+			t.Fatalf("node has %d out-edges, want 3", len(n.edges))
+		}
+		for _, e := range n.edges {
+			in[e]++
+			if _, ok := depth[e]; !ok {
+				depth[e] = depth[n] + 1
+				queue = append(queue, e)
+			}
+		}
+	}
+	if len(depth) != 81 {
+		t.Errorf("reached %d nodes, want 81", len(depth))
+	}
+	for n, d := range depth {
+		if d > 4 {
+			t.Errorf("node at depth %d, want <= 4", d)
+		}
+		if in[n] != 3 {
+			t.Errorf("node has %d in-edges, want 3", in[n])
+		}
+	}
+}
+
+func TestErdosRenyi(t *testing.T) {
+	const nodes, degree = 1000, 8
+	edges := edgeList(MakeErdosRenyi(nodes, degree, 1))
+	// The number of edges is binomial with mean nodes*degree and
+	// standard deviation < sqrt(nodes*degree) ≈ 89.
+	if n := len(edges); n < nodes*degree-500 || n > nodes*degree+500 {
+		t.Errorf("got %d edges, want about %d", n, nodes*degree)
+	}
+	seen := map[[2]int]bool{}
+	for _, e := range edges {
+		if seen[e] {
+			t.Fatalf("duplicate edge %v", e)
+		}
+		seen[e] = true
+	}
+}
+
+func TestPowerLaw(t *testing.T) {
+	const nodes, m = 10000, 2
+	in := make([]int, nodes)
+	for _, e := range edgeList(MakePowerLaw(nodes, m, 1)) {
+		if e[1] >= e[0] {
+			t.Fatalf("edge %v doesn't point to an earlier node", e)
+		}
+		in[e[1]]++
+	}
+	// A preferential attachment graph has hubs with far more
+	// in-edges than the mean of m.
+	max := 0
+	for _, n := range in {
+		if n > max {
+			max = n
+		}
+	}
+	if max < 20*m {
+		t.Errorf("largest in-degree is %d, want a hub with >= %d", max, 20*m)
+	}
+}
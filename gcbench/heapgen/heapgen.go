@@ -5,8 +5,10 @@
 package heapgen
 
 import (
+	"fmt"
 	"runtime"
-//aqui	"runtime/debug"
+	"runtime/debug"
+	"sort"
 	"sync"
 )
 
@@ -16,56 +18,194 @@ type Measurement struct {
 	Gen func() interface{}
 
 	// BytesRetained is the bytes of heap retained by the result
-	// of Gen().
+	// of Gen(), including fragmentation in the spans that hold
+	// the objects. This is the median of Samples measurements.
 	BytesRetained int
 
+	// BytesRetainedLow and BytesRetainedHigh bound BytesRetained.
+	// They are the smallest and largest of the samples, which for
+	// n samples is a 1-2/2**n confidence interval for the median
+	// (93.75% for the default of 5 samples).
+	BytesRetainedLow, BytesRetainedHigh int
+
+	// ObjectBytesRetained is the total size of the objects
+	// retained by the result of Gen(), not counting fragmentation
+	// in the spans that hold them. This is the median of the
+	// samples. Unlike BytesRetained, it doesn't depend on how
+	// objects are packed into spans, so if Gen() always produces
+	// the same objects, it is almost always the same on every run
+	// and at every GOMAXPROCS.
+	ObjectBytesRetained int
+
+	// PointerBytesRetained is the part of ObjectBytesRetained
+	// that the garbage collector must scan for pointers, and
+	// ScalarBytesRetained is the rest. PointerBytesRetained is -1
+	// if the runtime doesn't report scannable heap (before Go
+	// 1.21), in which case ScalarBytesRetained is also -1.
+	PointerBytesRetained, ScalarBytesRetained int
+
 	// ObjectsRetained is the number of objects retained by the
-	// result of Gen().
+	// result of Gen(). This is the median of the samples.
 	ObjectsRetained int
 
-	// BytesGarbage is the bytes of non-retained garbage produced
-	// by calling Gen().
+	// BytesAllocated and Allocs are the bytes and number of
+	// objects allocated by a call to Gen(). Allocs counts each
+	// block of combined tiny allocations once. These are the
+	// median of the samples.
+	BytesAllocated, Allocs int
+
+	// BytesGarbage is the bytes of objects allocated by a call to
+	// Gen() that it did not retain. This is the median of the
+	// samples.
 	BytesGarbage int
+
+	// Samples is the number of times Gen() was measured.
+	Samples int
 }
 
+// MeasureSamples is the number of samples Measure takes.
+var MeasureSamples = 5
+
+// maxSpread is the largest spread of the samples of
+// ObjectBytesRetained, relative to their median, that Measure accepts
+// before deciding the system isn't idle.
+const maxSpread = 0.05
+
 var sink interface{}
 
-// Measure measures gen's effect on the heap. The system must be
-// otherwise idle.
-func Measure(gen func() interface{}) Measurement {
-	// Warm up the generator.
+// Measure measures gen's effect on the heap by calling it
+// MeasureSamples times. The system must be otherwise idle: Measure
+// returns an error if the garbage collector runs while gen is running
+// or if the samples vary too much to be trusted, both of which
+// indicate that something else is allocating.
+//
+// Measure disables the garbage collector while gen runs, so gen's
+// garbage is still in the heap to be counted, and runs with GOMAXPROCS
+// set to 1, so the estimates don't depend on how many Ps are caching
+// partly-used spans. It uses runtime/metrics where the runtime
+// supports the necessary metrics and runtime.MemStats otherwise.
+func Measure(gen func() interface{}) (Measurement, error) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	// Warm up the generator and the runtime's statistics, which
+	// allocate on first use.
 	gen()
+	readHeapStats()
 
+	n := MeasureSamples
+	if n < 1 {
+		n = 1
+	}
+	var retained, objectBytes, pointerBytes, objects, allocBytes, allocs, garbage []int
+	for i := 0; i < n; i++ {
+		s, err := measure1(gen)
+		if err != nil {
+			sink = nil
+			return Measurement{}, err
+		}
+		retained = append(retained, s.retained)
+		objectBytes = append(objectBytes, s.objectBytes)
+		pointerBytes = append(pointerBytes, s.pointerBytes)
+		objects = append(objects, s.objects)
+		allocBytes = append(allocBytes, s.allocBytes)
+		allocs = append(allocs, s.allocs)
+		garbage = append(garbage, s.allocBytes-s.objectBytes)
+	}
+	sink = nil
+
+	m := Measurement{
+		Gen:                 gen,
+		BytesRetained:       median(retained),
+		ObjectBytesRetained: median(objectBytes),
+		ObjectsRetained:     median(objects),
+		BytesAllocated:      median(allocBytes),
+		Allocs:              median(allocs),
+		BytesGarbage:        median(garbage),
+		Samples:             n,
+	}
+	m.BytesRetainedLow, m.BytesRetainedHigh = retained[0], retained[n-1]
+	m.PointerBytesRetained, m.ScalarBytesRetained = -1, -1
+	if pointerBytes[0] >= 0 {
+		m.PointerBytesRetained = median(pointerBytes)
+		m.ScalarBytesRetained = m.ObjectBytesRetained - m.PointerBytesRetained
+	}
+
+	// objectBytes is sorted now.
+	if spread := objectBytes[n-1] - objectBytes[0]; float64(spread) > maxSpread*float64(m.ObjectBytesRetained) {
+		return m, fmt.Errorf("retained object bytes varied from %d to %d across samples; is the system idle?", objectBytes[0], objectBytes[n-1])
+	}
+	if m.ObjectBytesRetained < 0 || m.BytesGarbage < 0 {
+		return m, fmt.Errorf("heap shrank while measuring (retained %d bytes, %d bytes of garbage); is the system idle?", m.ObjectBytesRetained, m.BytesGarbage)
+	}
+	return m, nil
+}
+
+type sample struct {
+	retained, objectBytes, pointerBytes, objects int
+	allocBytes, allocs                           int
+}
+
+// measure1 takes one sample of gen's effect on the heap.
+func measure1(gen func() interface{}) (sample, error) {
 	// Clear the sink and GC everything.
 	sink = nil
 	runtime.GC()
 	runtime.GC()
+	s0 := readHeapStats()
 
-	// Measure total heap generated.
-	var mstats0 runtime.MemStats
-	runtime.ReadMemStats(&mstats0)
-//aqui	gogc := debug.SetGCPercent(-1)
+	// Generate with the garbage collector off, so everything gen
+	// allocates is still in the heap.
+	gogc := debug.SetGCPercent(-1)
 	sink = gen()
-	var mstats1 runtime.MemStats
-	runtime.ReadMemStats(&mstats1)
-//aqui	debug.SetGCPercent(gogc)
+	s1 := readHeapStats()
+	debug.SetGCPercent(gogc)
+	if s1.gcs != s0.gcs {
+		return sample{}, fmt.Errorf("garbage collector ran while generating; is the system idle?")
+	}
+
 	// GC and measure retained heap.
 	runtime.GC()
 	runtime.GC()
-	var mstats2 runtime.MemStats
-	runtime.ReadMemStats(&mstats2)
-
-	return Measurement{
-		Gen:             gen,
-		BytesRetained:   int(mstats2.HeapInuse - mstats0.HeapInuse),
-		ObjectsRetained: int(mstats2.HeapObjects - mstats0.HeapObjects),
-		BytesGarbage:    int(mstats1.HeapInuse - mstats2.HeapInuse),
+	s2 := readHeapStats()
+
+	s := sample{
+		retained:     int(s2.inuseBytes - s0.inuseBytes),
+		objectBytes:  int(s2.objectBytes - s0.objectBytes),
+		pointerBytes: -1,
+		objects:      int(s2.objects - s0.objects),
+		// The runtime counts allocations when Ps flush their
+		// cached spans, which GC forces, so use s2 rather than s1.
+		allocBytes: int(s2.allocBytes - s0.allocBytes),
+		allocs:     int(s2.allocs - s0.allocs),
 	}
+	if s0.scanBytes >= 0 {
+		s.pointerBytes = int(s2.scanBytes - s0.scanBytes)
+	}
+	return s, nil
+}
+
+// median sorts xs and returns its median.
+func median(xs []int) int {
+	sort.Ints(xs)
+	if len(xs)%2 == 1 {
+		return xs[len(xs)/2]
+	}
+	return (xs[len(xs)/2-1] + xs[len(xs)/2]) / 2
 }
 
 // Generate generates garbage by running gen() bytesGoal/bytes1 times.
 // It returns an object that retains all objects returned by gen.
 func Generate(gen func() interface{}, bytes1, bytesGoal int) interface{} {
+	return GenerateSeeded(func(int64) interface{} { return gen() }, 0, bytes1, bytesGoal)
+}
+
+// GenerateSeeded is like Generate, but calls gen(seed+i) for the i'th
+// object, so the objects depend only on seed and not on how the work
+// is split across goroutines. If gen is a function of its seed, the
+// result is the same object graph on every run and at every
+// GOMAXPROCS, as long as bytes1 and bytesGoal are the same. To keep
+// bytes1 the same, use Measurement.ObjectBytesRetained.
+func GenerateSeeded(gen func(seed int64) interface{}, seed int64, bytes1, bytesGoal int) interface{} {
 	count := (bytesGoal + bytes1 - 1) / bytes1
 	out := make([]interface{}, count)
 	procs := runtime.GOMAXPROCS(-1)
@@ -74,7 +214,7 @@ func Generate(gen func() interface{}, bytes1, bytesGoal int) interface{} {
 	for p := 0; p < procs; p++ {
 		go func(p int) {
 			for i := p; i < len(out); i += procs {
-				out[i] = gen()
+				out[i] = gen(seed + int64(i))
 			}
 			wg.Done()
 		}(p)
@@ -82,4 +222,3 @@ func Generate(gen func() interface{}, bytes1, bytesGoal int) interface{} {
 	wg.Wait()
 	return out
 }
-
@@ -0,0 +1,74 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapgen
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestGenerateSeeded(t *testing.T) {
+	gen, err := SeededShape("random:nodes=50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	generate := func(procs int) [][][2]int {
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+		var graphs [][][2]int
+		for _, g := range GenerateSeeded(gen, 42, 1, 16).([]interface{}) {
+			graphs = append(graphs, edgeList(g))
+		}
+		return graphs
+	}
+	g1, g4 := generate(1), generate(4)
+	if len(g1) != 16 {
+		t.Fatalf("generated %d graphs, want 16", len(g1))
+	}
+	if !reflect.DeepEqual(g1, g4) {
+		t.Errorf("graphs differ between GOMAXPROCS=1 and GOMAXPROCS=4")
+	}
+	if reflect.DeepEqual(g1[0], g1[1]) {
+		t.Errorf("graphs with different seeds are identical")
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	m, err := Measure(func() interface{} { return MakeTree(10) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Samples != MeasureSamples {
+		t.Errorf("got %d samples, want %d", m.Samples, MeasureSamples)
+	}
+	if !(m.BytesRetainedLow <= m.BytesRetained && m.BytesRetained <= m.BytesRetainedHigh) {
+		t.Errorf("BytesRetained %d not within [%d, %d]", m.BytesRetained, m.BytesRetainedLow, m.BytesRetainedHigh)
+	}
+	// 2047 16-byte nodes, give or take other objects in the
+	// process.
+	if m.ObjectsRetained < 2000 || m.ObjectsRetained > 2100 || m.ObjectBytesRetained < 2000*16 || m.ObjectBytesRetained > 2100*16 {
+		t.Errorf("retained %d objects of %d bytes, want about 2047 of %d", m.ObjectsRetained, m.ObjectBytesRetained, 2047*16)
+	}
+	if m.PointerBytesRetained >= 0 && m.PointerBytesRetained+m.ScalarBytesRetained != m.ObjectBytesRetained {
+		t.Errorf("%d pointer bytes + %d scalar bytes != %d object bytes", m.PointerBytesRetained, m.ScalarBytesRetained, m.ObjectBytesRetained)
+	}
+
+	// Measure sees garbage even though it's allocated in bulk.
+	m, err = Measure(func() interface{} {
+		for i := 0; i < 100; i++ {
+			sink = make([]byte, 64<<10)
+		}
+		return MakeBlobs(1, 64<<10)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.BytesGarbage < 99*64<<10 || m.Allocs < 101 {
+		t.Errorf("got %d bytes of garbage in %d allocations, want at least %d in 101", m.BytesGarbage, m.Allocs, 99*64<<10)
+	}
+	if m.PointerBytesRetained > 1024 {
+		t.Errorf("retained %d pointer bytes from a byte slice", m.PointerBytesRetained)
+	}
+}
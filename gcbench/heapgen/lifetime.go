@@ -0,0 +1,419 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapgen
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// A Lifetime is a distribution of object lifetimes.
+type Lifetime interface {
+	// Sample returns a lifetime drawn from the distribution.
+	Sample(r *rand.Rand) time.Duration
+
+	// Mean returns the mean of the distribution.
+	Mean() time.Duration
+}
+
+type expLifetime struct {
+	mean time.Duration
+}
+
+// ExponentialLifetime returns an exponential distribution of
+// lifetimes with the given mean. Objects are equally likely to die at
+// any point regardless of their age.
+func ExponentialLifetime(mean time.Duration) Lifetime {
+	if mean <= 0 {
+		panic("bad mean lifetime")
+	}
+	return expLifetime{mean}
+}
+
+func (l expLifetime) Sample(r *rand.Rand) time.Duration {
+	return time.Duration(r.ExpFloat64() * float64(l.mean))
+}
+
+func (l expLifetime) Mean() time.Duration {
+	return l.mean
+}
+
+func (l expLifetime) sampleRemaining(r *rand.Rand) time.Duration {
+	// Exponential lifetimes are memoryless.
+	return l.Sample(r)
+}
+
+type bimodalLifetime struct {
+	short, long Lifetime
+	longFrac    float64
+}
+
+// BimodalLifetime returns a mixture of two exponential distributions
+// of lifetimes with means short and long, where a fraction longFrac
+// of objects are long-lived. This is the classic generational
+// workload: most objects die young, but the few that don't live much
+// longer.
+func BimodalLifetime(short, long time.Duration, longFrac float64) Lifetime {
+	if !(0 <= longFrac && longFrac <= 1) {
+		panic("bad long-lived fraction")
+	}
+	return bimodalLifetime{ExponentialLifetime(short), ExponentialLifetime(long), longFrac}
+}
+
+func (l bimodalLifetime) Sample(r *rand.Rand) time.Duration {
+	if r.Float64() < l.longFrac {
+		return l.long.Sample(r)
+	}
+	return l.short.Sample(r)
+}
+
+func (l bimodalLifetime) Mean() time.Duration {
+	return time.Duration((1-l.longFrac)*float64(l.short.Mean()) + l.longFrac*float64(l.long.Mean()))
+}
+
+func (l bimodalLifetime) sampleRemaining(r *rand.Rand) time.Duration {
+	// Live objects are long-lived in proportion to the time they
+	// spend live, and each mode is memoryless.
+	longLive := l.longFrac * float64(l.long.Mean())
+	if r.Float64()*float64(l.Mean()) < longLive {
+		return l.long.Sample(r)
+	}
+	return l.short.Sample(r)
+}
+
+type paretoLifetime struct {
+	min   time.Duration
+	alpha float64
+}
+
+// ParetoLifetime returns a Pareto distribution of lifetimes with
+// minimum min and shape alpha. Smaller values of alpha give heavier
+// tails: the longer an object has lived, the longer it's likely to
+// keep living. alpha must be greater than 1 so the mean is finite.
+func ParetoLifetime(min time.Duration, alpha float64) Lifetime {
+	if min <= 0 || !(alpha > 1) {
+		panic("bad Pareto min or alpha")
+	}
+	return paretoLifetime{min, alpha}
+}
+
+func (l paretoLifetime) Sample(r *rand.Rand) time.Duration {
+	// Inverse transform sampling. 1-Float64() is in (0, 1].
+	d := float64(l.min) / math.Pow(1-r.Float64(), 1/l.alpha)
+	if d > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(d)
+}
+
+func (l paretoLifetime) Mean() time.Duration {
+	return time.Duration(l.alpha * float64(l.min) / (l.alpha - 1))
+}
+
+func (l paretoLifetime) sampleRemaining(r *rand.Rand) time.Duration {
+	// Inverse transform sampling of the equilibrium distribution,
+	// whose CDF is the integral of the survival function divided
+	// by the mean. It's uniform up to min and then has a Pareto
+	// tail with shape alpha-1.
+	u := r.Float64()
+	if u < (l.alpha-1)/l.alpha {
+		return time.Duration(u * float64(l.Mean()))
+	}
+	d := float64(l.min) / math.Pow(l.alpha*(1-u), 1/(l.alpha-1))
+	if d > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(d)
+}
+
+// A remainingSampler is a Lifetime that can sample the remaining
+// lifetime of an object that is live at a random time in a steady
+// state.
+type remainingSampler interface {
+	sampleRemaining(r *rand.Rand) time.Duration
+}
+
+// ParseLifetime returns the Lifetime described by spec, which has the
+// same form as a Shape spec. The distributions are
+//
+//	exp:mean=D                           ExponentialLifetime(D)
+//	bimodal:short=D1,long=D2,long-frac=F BimodalLifetime(D1, D2, F)
+//	pareto:min=D,alpha=A                 ParetoLifetime(D, A)
+//
+// where D is a duration such as "100ms". Parameters that aren't set
+// default to mean=1s; short=10ms, long=10s, long-frac=0.05; and
+// min=10ms, alpha=1.5.
+func ParseLifetime(spec string) (Lifetime, error) {
+	name, settings, err := parseSpec(spec)
+	if err != nil {
+		return nil, fmt.Errorf("lifetime %q: %v", spec, err)
+	}
+	durs := map[string]time.Duration{}
+	floats := map[string]float64{}
+	switch name {
+	case "exp":
+		durs["mean"] = time.Second
+	case "bimodal":
+		durs["short"], durs["long"] = 10*time.Millisecond, 10*time.Second
+		floats["long-frac"] = 0.05
+	case "pareto":
+		durs["min"] = 10 * time.Millisecond
+		floats["alpha"] = 1.5
+	default:
+		return nil, fmt.Errorf("unknown lifetime distribution %q", name)
+	}
+	for _, setting := range settings {
+		k, v := setting[0], setting[1]
+		if _, ok := durs[k]; ok {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("lifetime %q: bad value %q for %s", spec, v, k)
+			}
+			durs[k] = d
+		} else if _, ok := floats[k]; ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("lifetime %q: bad value %q for %s", spec, v, k)
+			}
+			floats[k] = f
+		} else {
+			return nil, fmt.Errorf("lifetime %q: unknown param %q", spec, k)
+		}
+	}
+	switch name {
+	case "exp":
+		return ExponentialLifetime(durs["mean"]), nil
+	case "bimodal":
+		if f := floats["long-frac"]; !(0 <= f && f <= 1) {
+			return nil, fmt.Errorf("lifetime %q: long-frac must be between 0 and 1", spec)
+		}
+		return BimodalLifetime(durs["short"], durs["long"], floats["long-frac"]), nil
+	default:
+		if !(floats["alpha"] > 1) {
+			return nil, fmt.Errorf("lifetime %q: alpha must be greater than 1", spec)
+		}
+		return ParetoLifetime(durs["min"], floats["alpha"]), nil
+	}
+}
+
+// A LifetimeHeap allocates objects at a steady rate and retains each
+// for a lifetime drawn from a distribution, keeping the live heap
+// around a target. Unlike the ballast from Generate, which never dies,
+// and the garbage from a Churner, which dies immediately, this models
+// caches and session state, whose objects survive several GC cycles
+// and then die.
+//
+// By Little's law, the live heap is the allocation rate times the mean
+// lifetime, so LifetimeHeap allocates LiveBytes/Lifetime.Mean() bytes
+// per second.
+type LifetimeHeap struct {
+	// Gen generates each object. If Gen is nil, each object is a
+	// 64-byte object containing a pointer.
+	Gen func() interface{}
+
+	// ObjectBytes is the bytes of heap retained by each call to
+	// Gen. If it is 0, Start measures Gen.
+	ObjectBytes int
+
+	// Lifetime is the distribution of object lifetimes.
+	Lifetime Lifetime
+
+	// LiveBytes is the target live heap size.
+	LiveBytes int
+
+	// Seed seeds the lifetime samples.
+	Seed int64
+
+	live          int64 // Number of live objects; accessed atomically
+	allocated     int64 // Objects allocated by Start; accessed atomically
+	stop, stopped chan struct{}
+}
+
+type lifetimeObject struct {
+	next *lifetimeObject
+	data [7]uintptr
+}
+
+// lifetimeTick is how often a LifetimeHeap allocates and releases
+// objects.
+const lifetimeTick = time.Millisecond
+
+// lifetimeMaxLag is how far a LifetimeHeap's allocation can fall
+// behind schedule. A tick allocates at most this much time's worth of
+// objects, and allocation more than this far behind is skipped rather
+// than made up, so the achieved allocation rate drops instead.
+const lifetimeMaxLag = 100 * lifetimeTick
+
+// lifetimeBatch is how many objects a LifetimeHeap allocates between
+// checking whether it's been stopped.
+const lifetimeBatch = 256
+
+// Start starts allocating objects in the background. To reach the
+// target live heap right away rather than after several lifetimes,
+// Start first allocates LiveBytes of objects with the remaining
+// lifetimes they would have in a steady state. For a Lifetime other
+// than those in this package, it draws these from the distribution of
+// lifetimes instead, and the live heap drifts before it settles.
+//
+// If Gen is too slow to keep up with the allocation rate, the
+// achieved rate and live heap are lower than the target. Use
+// Allocated and Live to find the achieved values.
+//
+// Start returns an error if it needs to measure Gen and can't.
+func (h *LifetimeHeap) Start() error {
+	if h.stop != nil {
+		panic("LifetimeHeap already running")
+	}
+	if h.Gen == nil {
+		h.Gen = func() interface{} { return new(lifetimeObject) }
+		if h.ObjectBytes == 0 {
+			h.ObjectBytes = 64
+		}
+	}
+	if h.ObjectBytes == 0 {
+		m, err := Measure(h.Gen)
+		if err != nil {
+			return err
+		}
+		h.ObjectBytes = m.ObjectBytesRetained
+	}
+	if h.ObjectBytes <= 0 || h.LiveBytes <= 0 || h.Lifetime == nil {
+		panic("LifetimeHeap needs ObjectBytes, LiveBytes and Lifetime")
+	}
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	h.stop, h.stopped = stop, stopped
+
+	rng := rand.New(rand.NewSource(h.Seed))
+	objsPerSec := float64(h.LiveBytes) / float64(h.ObjectBytes) / h.Lifetime.Mean().Seconds()
+	maxLag := objsPerSec * lifetimeMaxLag.Seconds()
+	var q deathQueue
+	// Times are relative to start.
+	start := time.Now()
+	remaining := h.Lifetime.Sample
+	if l, ok := h.Lifetime.(remainingSampler); ok {
+		remaining = l.sampleRemaining
+	}
+	for i := 0; i < h.LiveBytes/h.ObjectBytes; i++ {
+		q.push(deathEntry{remaining(rng), h.Gen()})
+	}
+	atomic.StoreInt64(&h.live, int64(len(q)))
+	atomic.StoreInt64(&h.allocated, 0)
+
+	go func() {
+		ticker := time.NewTicker(lifetimeTick)
+		defer ticker.Stop()
+		// allocated is the number of objects the schedule has
+		// allocated, including skipped ones.
+		allocated := 0.0
+	loop:
+		for {
+			select {
+			case <-stop:
+				break loop
+			case <-ticker.C:
+			}
+			now := time.Since(start)
+			// Allocate based on elapsed time, so a delayed
+			// tick catches up rather than lowering the rate,
+			// but by at most maxLag objects.
+			want := objsPerSec * now.Seconds()
+			if allocated < want-maxLag {
+				allocated = want - maxLag
+			}
+			n := 0
+			for allocated < want {
+				// Release the objects that died before
+				// this one was due, so the queue doesn't
+				// grow while we catch up.
+				t := time.Duration(allocated / objsPerSec * float64(time.Second))
+				q.popUntil(t)
+				q.push(deathEntry{t + h.Lifetime.Sample(rng), h.Gen()})
+				allocated++
+				if n++; n%lifetimeBatch == 0 {
+					select {
+					case <-stop:
+						break loop
+					default:
+					}
+				}
+			}
+			atomic.AddInt64(&h.allocated, int64(n))
+			q.popUntil(now)
+			atomic.StoreInt64(&h.live, int64(len(q)))
+		}
+		atomic.StoreInt64(&h.live, 0)
+		close(stopped)
+	}()
+	return nil
+}
+
+// Stop stops allocating objects and releases all live objects.
+func (h *LifetimeHeap) Stop() {
+	close(h.stop)
+	<-h.stopped
+	h.stop, h.stopped = nil, nil
+}
+
+// Live returns the approximate bytes of heap currently retained by h.
+func (h *LifetimeHeap) Live() int {
+	return int(atomic.LoadInt64(&h.live)) * h.ObjectBytes
+}
+
+// Allocated returns the bytes of heap h has allocated since Start
+// filled the live heap.
+func (h *LifetimeHeap) Allocated() int {
+	return int(atomic.LoadInt64(&h.allocated)) * h.ObjectBytes
+}
+
+type deathEntry struct {
+	death time.Duration
+	obj   interface{}
+}
+
+// deathQueue is a min-heap of objects ordered by time of death.
+type deathQueue []deathEntry
+
+func (q *deathQueue) push(e deathEntry) {
+	*q = append(*q, e)
+	h := *q
+	for i := len(h) - 1; i > 0; {
+		parent := (i - 1) / 2
+		if h[parent].death <= h[i].death {
+			break
+		}
+		h[parent], h[i] = h[i], h[parent]
+		i = parent
+	}
+}
+
+// popUntil removes the objects that die at or before t.
+func (q *deathQueue) popUntil(t time.Duration) {
+	h := *q
+	for len(h) > 0 && h[0].death <= t {
+		n := len(h) - 1
+		h[0] = h[n]
+		h[n] = deathEntry{} // Release the object
+		h = h[:n]
+		for i := 0; ; {
+			min := i
+			if l := 2*i + 1; l < n && h[l].death < h[min].death {
+				min = l
+			}
+			if r := 2*i + 2; r < n && h[r].death < h[min].death {
+				min = r
+			}
+			if min == i {
+				break
+			}
+			h[i], h[min] = h[min], h[i]
+			i = min
+		}
+	}
+	*q = h
+}
@@ -0,0 +1,166 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapgen
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLifetimeMean(t *testing.T) {
+	for _, spec := range []string{"exp:mean=100ms", "bimodal:short=1ms,long=1s,long-frac=0.1", "pareto:min=1ms,alpha=3"} {
+		l, err := ParseLifetime(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := rand.New(rand.NewSource(1))
+		const n = 100000
+		var sum float64
+		for i := 0; i < n; i++ {
+			sum += float64(l.Sample(r))
+		}
+		if mean := sum / n; math.Abs(mean-float64(l.Mean()))/float64(l.Mean()) > 0.05 {
+			t.Errorf("%s: sample mean %v, want %v", spec, time.Duration(mean), l.Mean())
+		}
+	}
+
+	for spec, want := range map[string]string{
+		"weibull":               "unknown lifetime",
+		"exp:mean=x":            "bad value",
+		"exp:mean=-1s":          "bad value",
+		"exp:min=1s":            "unknown param",
+		"pareto:alpha=1":        "greater than 1",
+		"bimodal:long-frac=1.5": "between 0 and 1",
+	} {
+		_, err := ParseLifetime(spec)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseLifetime(%q): want error containing %q, got %v", spec, want, err)
+		}
+	}
+}
+
+func TestLifetimeRemaining(t *testing.T) {
+	// The mean remaining lifetime of a live object is
+	// E[L²]/(2 E[L]).
+	for spec, want := range map[string]time.Duration{
+		"exp:mean=100ms": 100 * time.Millisecond,
+		// (0.9·1ms² + 0.1·100ms²) / (0.9·1ms + 0.1·100ms) ≈ 91.83ms
+		"bimodal:short=1ms,long=100ms,long-frac=0.1": 91826 * time.Microsecond,
+		// E[L²] = α·min²/(α-2), E[L] = α·min/(α-1)
+		"pareto:min=1ms,alpha=4": 750 * time.Microsecond,
+	} {
+		l, err := ParseLifetime(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := rand.New(rand.NewSource(1))
+		const n = 100000
+		var sum float64
+		for i := 0; i < n; i++ {
+			sum += float64(l.(remainingSampler).sampleRemaining(r))
+		}
+		if mean := sum / n; math.Abs(mean-float64(want))/float64(want) > 0.05 {
+			t.Errorf("%s: mean remaining lifetime %v, want %v", spec, time.Duration(mean), want)
+		}
+	}
+}
+
+func TestDeathQueue(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var q deathQueue
+	for i := 0; i < 1000; i++ {
+		q.push(deathEntry{death: time.Duration(r.Intn(1000))})
+	}
+	for _, until := range []time.Duration{-1, 0, 250, 250, 999} {
+		q.popUntil(until)
+		for _, e := range q {
+			if e.death <= until {
+				t.Fatalf("after popUntil(%d), queue has death %d", until, e.death)
+			}
+		}
+	}
+	if len(q) != 0 {
+		t.Errorf("queue has %d entries after popping all", len(q))
+	}
+}
+
+func TestLifetimeHeap(t *testing.T) {
+	h := &LifetimeHeap{
+		Lifetime:  ExponentialLifetime(20 * time.Millisecond),
+		LiveBytes: 1 << 20,
+	}
+	if err := h.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Stop()
+	// The live heap starts at the target and stays around it.
+	if live := h.Live(); live != 1<<20 {
+		t.Errorf("initial live heap %d, want %d", live, 1<<20)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if live := h.Live(); live < 1<<19 || live > 2<<20 {
+		t.Errorf("live heap %d after 10 lifetimes, want about %d", live, 1<<20)
+	}
+}
+
+func TestLifetimeHeapBimodal(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	// The default lifetime of progs/lifetime, with a smaller heap.
+	// This allocates about 2 million objects per second, which
+	// may be more than a slow machine can keep up with.
+	lifetime, err := ParseLifetime("bimodal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const target = 64 << 20
+	h := &LifetimeHeap{Lifetime: lifetime, LiveBytes: target}
+	if err := h.Start(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	var sum, n, max int
+	for i := 0; i < 20; i++ {
+		time.Sleep(50 * time.Millisecond)
+		live := h.Live()
+		sum += live
+		n++
+		if live > max {
+			max = live
+		}
+	}
+	elapsed := time.Since(start)
+	allocated := h.Allocated()
+
+	// Stopping doesn't wait for allocation to catch up.
+	stopStart := time.Now()
+	h.Stop()
+	if d := time.Since(stopStart); d > time.Second {
+		t.Errorf("Stop took %v", d)
+	}
+	if h.Live() != 0 {
+		t.Errorf("live heap %d after Stop, want 0", h.Live())
+	}
+
+	// However fast allocation is, the live heap must not grow
+	// past the target.
+	if max > target*3/2 {
+		t.Errorf("live heap reached %d, want at most about %d", max, target)
+	}
+	// If allocation kept up, the live heap stays at the target
+	// from the start.
+	wantRate := float64(target) / lifetime.Mean().Seconds()
+	if rate := float64(allocated) / elapsed.Seconds(); rate < wantRate*0.9 {
+		t.Logf("allocated %.0f bytes/sec, want %.0f; not checking live heap", rate, wantRate)
+		return
+	}
+	if mean := sum / n; mean < target*3/4 || mean > target*5/4 {
+		t.Errorf("mean live heap %d, want about %d", mean, target)
+	}
+}
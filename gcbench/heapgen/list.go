@@ -0,0 +1,25 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapgen
+
+type listNode struct {
+	next *listNode
+	val  int
+}
+
+// MakeList constructs a singly linked list of length objects. A list
+// is the worst case for parallel mark: every object must be marked
+// before the next one is discovered, so only one worker can make
+// progress on it at a time.
+func MakeList(length int) interface{} {
+	if length <= 0 {
+		panic("bad length")
+	}
+	var head *listNode
+	for i := 0; i < length; i++ {
+		head = &listNode{head, i}
+	}
+	return head
+}
@@ -0,0 +1,29 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapgen
+
+type mapValue struct {
+	key  int
+	next *mapValue
+	data [2]int
+}
+
+// MakeMap constructs a Go map with entries entries. Each value is a
+// pointer to a separate object, and each of those points to the
+// value of the previous key, so the heap consists of the map's bucket
+// array plus a web of small objects hanging off it.
+func MakeMap(entries int) interface{} {
+	if entries <= 0 {
+		panic("bad entries")
+	}
+	m := make(map[int]*mapValue)
+	var prev *mapValue
+	for i := 0; i < entries; i++ {
+		v := &mapValue{key: i, next: prev}
+		m[i] = v
+		prev = v
+	}
+	return m
+}
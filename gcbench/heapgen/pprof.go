@@ -0,0 +1,538 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapgen
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// A HeapProfile summarizes the in-use heap of a pprof heap profile by
+// object size.
+type HeapProfile struct {
+	// Classes lists the in-use objects by size and pointer-ness,
+	// sorted by size.
+	Classes []ObjectClass
+}
+
+// An ObjectClass is a set of in-use objects of the same size.
+type ObjectClass struct {
+	// Size is the size of each object in bytes.
+	Size int
+
+	// Objects is the number of in-use objects.
+	Objects int64
+
+	// PointerFree indicates that the objects were allocated by
+	// functions that allocate pointer-free memory, such as
+	// strings and byte slices. Heap profiles don't record object
+	// types, so this is a guess from the allocation stack.
+	PointerFree bool
+}
+
+// Bytes returns the total in-use bytes of p.
+func (p *HeapProfile) Bytes() int64 {
+	var total int64
+	for _, c := range p.Classes {
+		total += int64(c.Size) * c.Objects
+	}
+	return total
+}
+
+// pointerFreeAllocators are functions that allocate pointer-free
+// memory. If the innermost of these frames in an allocation stack is
+// one of them, ReadHeapProfile assumes the objects are pointer-free.
+var pointerFreeAllocators = map[string]bool{
+	"runtime.rawstring":                          true,
+	"runtime.rawstringtmp":                       true,
+	"runtime.rawbyteslice":                       true,
+	"runtime.rawruneslice":                       true,
+	"runtime.slicebytetostring":                  true,
+	"runtime.stringtoslicebyte":                  true,
+	"runtime.stringtoslicerune":                  true,
+	"runtime.concatstrings":                      true,
+	"runtime.intstring":                          true,
+	"internal/bytealg.MakeNoZero":                true,
+	"bytes.makeSlice":                            true,
+	"bytes.growSlice":                            true,
+	"strings.(*Builder).grow":                    true,
+	"strings.Repeat":                             true,
+	"io.ReadAll":                                 true,
+	"io/ioutil.ReadAll":                          true,
+	"os.ReadFile":                                true,
+	"bufio.NewReaderSize":                        true,
+	"bufio.NewWriterSize":                        true,
+	"compress/flate.NewWriter":                   true,
+	"encoding/base64.(*Encoding).EncodeToString": true,
+}
+
+// ReadHeapProfile reads the in-use heap from a pprof heap profile in
+// the protocol buffer format written by runtime/pprof, optionally
+// gzip-compressed.
+func ReadHeapProfile(r io.Reader) (*HeapProfile, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		r = gz
+	} else {
+		r = br
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	prof, err := decodeProfile(data)
+	if err != nil {
+		return nil, fmt.Errorf("malformed heap profile: %v", err)
+	}
+
+	// Find the in-use sample values.
+	objIdx, spaceIdx := -1, -1
+	for i, st := range prof.sampleTypes {
+		switch prof.str(st) {
+		case "inuse_objects":
+			objIdx = i
+		case "inuse_space":
+			spaceIdx = i
+		}
+	}
+	if objIdx < 0 || spaceIdx < 0 {
+		return nil, errors.New("not a heap profile: no inuse_objects and inuse_space samples")
+	}
+
+	type classKey struct {
+		size        int
+		pointerFree bool
+	}
+	classes := make(map[classKey]int64)
+	for _, s := range prof.samples {
+		if objIdx >= len(s.values) || spaceIdx >= len(s.values) {
+			return nil, errors.New("malformed heap profile: sample missing values")
+		}
+		objs, space := s.values[objIdx], s.values[spaceIdx]
+		if objs <= 0 || space <= 0 {
+			continue
+		}
+		// Go heap profiles label each sample with the object
+		// size, but fall back to the average.
+		size := int(space / objs)
+		if s.bytes > 0 {
+			size = int(s.bytes)
+		}
+		k := classKey{size, prof.pointerFree(s.locations)}
+		classes[k] += objs
+	}
+
+	p := new(HeapProfile)
+	for k, objs := range classes {
+		p.Classes = append(p.Classes, ObjectClass{k.size, objs, k.pointerFree})
+	}
+	sort.Slice(p.Classes, func(i, j int) bool {
+		ci, cj := p.Classes[i], p.Classes[j]
+		if ci.Size != cj.Size {
+			return ci.Size < cj.Size
+		}
+		return !ci.PointerFree && cj.PointerFree
+	})
+	return p, nil
+}
+
+// ReadHeapProfileFile is like ReadHeapProfile, but reads from the
+// named file.
+func ReadHeapProfileFile(path string) (*HeapProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := ReadHeapProfile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return p, nil
+}
+
+// MakeProfileHeap constructs a heap of about size bytes with the same
+// distribution of object sizes as p. Pointer-free objects have no
+// pointers. In other objects, a fraction ptrFrac of the words are
+// pointers to random objects in the constructed heap. The result
+// retains all of the objects. It is a function of seed.
+//
+// Classes with too few objects to be represented in a heap of the
+// given size are included at random with the right probability, so
+// over many calls with different seeds, as from GenerateSeeded, the
+// object size distribution matches p even for large objects.
+func MakeProfileHeap(p *HeapProfile, size int, ptrFrac float64, seed int64) interface{} {
+	total := p.Bytes()
+	if total == 0 || size <= 0 || !(0 <= ptrFrac && ptrFrac <= 1) {
+		panic("bad profile, size or pointer fraction")
+	}
+	rng := rand.New(rand.NewSource(seed))
+	scale := float64(size) / float64(total)
+
+	var objs []unsafe.Pointer
+	var ptrs [][]unsafe.Pointer
+	for _, c := range p.Classes {
+		// Round randomly so the expected count is exact.
+		want := float64(c.Objects) * scale
+		n := int(want)
+		if rng.Float64() < want-float64(n) {
+			n++
+		}
+		typ := objectType(c, ptrFrac)
+		for i := 0; i < n; i++ {
+			v := reflect.New(typ)
+			objs = append(objs, unsafe.Pointer(v.Pointer()))
+			if typ.Kind() == reflect.Struct {
+				ptrs = append(ptrs, v.Elem().Field(0).Slice(0, typ.Field(0).Type.Len()).Interface().([]unsafe.Pointer))
+			}
+		}
+	}
+	// Wire up the pointers.
+	for _, ps := range ptrs {
+		for i := range ps {
+			ps[i] = objs[rng.Intn(len(objs))]
+		}
+	}
+	return objs
+}
+
+var objectTypes = struct {
+	sync.Mutex
+	m map[[2]int]reflect.Type
+}{m: make(map[[2]int]reflect.Type)}
+
+// objectType returns the type to use for objects of class c. This is
+// a byte array for pointer-free objects and otherwise a struct whose
+// first field is an array of pointers and whose second is an array of
+// scalar words.
+func objectType(c ObjectClass, ptrFrac float64) reflect.Type {
+	words := c.Size / 8
+	nptr := int(math.Floor(ptrFrac*float64(words) + 0.5))
+	if nptr == 0 && ptrFrac > 0 && words > 0 {
+		nptr = 1
+	}
+	if c.PointerFree || nptr == 0 {
+		return reflect.ArrayOf(c.Size, reflect.TypeOf(byte(0)))
+	}
+	k := [2]int{nptr, words - nptr}
+	objectTypes.Lock()
+	defer objectTypes.Unlock()
+	if t, ok := objectTypes.m[k]; ok {
+		return t
+	}
+	t := reflect.StructOf([]reflect.StructField{
+		{Name: "P", Type: reflect.ArrayOf(k[0], reflect.TypeOf(unsafe.Pointer(nil)))},
+		{Name: "S", Type: reflect.ArrayOf(k[1], reflect.TypeOf(uintptr(0)))},
+	})
+	objectTypes.m[k] = t
+	return t
+}
+
+// profileShape returns the generator for a "pprof" heap shape. Unlike
+// other shapes, it takes a file name parameter.
+func profileShape(spec string, settings [][2]string) (func(seed int64) interface{}, error) {
+	file, size, ptrFrac := "", 1<<20, 0.5
+	for _, setting := range settings {
+		k, v := setting[0], setting[1]
+		var err error
+		switch k {
+		case "file":
+			file = v
+		case "size":
+			size, err = strconv.Atoi(v)
+			if err == nil && size <= 0 {
+				err = errors.New("must be positive")
+			}
+		case "ptrfrac":
+			ptrFrac, err = strconv.ParseFloat(v, 64)
+			if err == nil && !(0 <= ptrFrac && ptrFrac <= 1) {
+				err = errors.New("must be between 0 and 1")
+			}
+		default:
+			return nil, fmt.Errorf("heap shape %q: unknown param %q", spec, k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("heap shape %q: bad value %q for %s", spec, v, k)
+		}
+	}
+	if file == "" {
+		return nil, fmt.Errorf("heap shape %q: missing file param", spec)
+	}
+	p, err := ReadHeapProfileFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if p.Bytes() == 0 {
+		return nil, fmt.Errorf("%s: no in-use heap", file)
+	}
+	return func(seed int64) interface{} {
+		return MakeProfileHeap(p, size, ptrFrac, seed)
+	}, nil
+}
+
+// profile is the subset of a decoded pprof profile.proto Profile
+// that ReadHeapProfile needs.
+type profile struct {
+	sampleTypes []int64 // String table indexes of sample type names
+	samples     []pprofSample
+	locations   map[uint64][]uint64 // Location ID to function IDs, innermost first
+	functions   map[uint64]int64    // Function ID to name string index
+	strings     []string
+}
+
+type pprofSample struct {
+	locations []uint64
+	values    []int64
+	bytes     int64 // Value of the "bytes" label, or 0
+}
+
+func (p *profile) str(i int64) string {
+	if i < 0 || i >= int64(len(p.strings)) {
+		return ""
+	}
+	return p.strings[i]
+}
+
+// pointerFree reports whether the innermost known allocator in stack
+// allocates pointer-free memory.
+func (p *profile) pointerFree(stack []uint64) bool {
+	for _, loc := range stack {
+		for _, fn := range p.locations[loc] {
+			name := p.str(p.functions[fn])
+			if pointerFreeAllocators[name] {
+				return true
+			}
+			if !strings.HasPrefix(name, "runtime.") {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+// Field numbers from profile.proto.
+const (
+	profileSampleType  = 1
+	profileSample      = 2
+	profileLocation    = 4
+	profileFunction    = 5
+	profileStringTable = 6
+
+	valueTypeType = 1
+
+	sampleLocationID = 1
+	sampleValue      = 2
+	sampleLabel      = 3
+
+	labelKey = 1
+	labelNum = 3
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+
+	functionID   = 1
+	functionName = 2
+)
+
+func decodeProfile(data []byte) (*profile, error) {
+	p := &profile{
+		locations: make(map[uint64][]uint64),
+		functions: make(map[uint64]int64),
+	}
+	// Labels refer to the string table, which may come last, so
+	// resolve them afterwards.
+	type label struct {
+		sample   int
+		key, num int64
+	}
+	var labels []label
+	err := decodeMessage(data, func(field int, v uint64, b []byte) error {
+		switch field {
+		case profileSampleType:
+			return decodeMessage(b, func(field int, v uint64, b []byte) error {
+				if field == valueTypeType {
+					p.sampleTypes = append(p.sampleTypes, int64(v))
+				}
+				return nil
+			})
+		case profileSample:
+			var s pprofSample
+			err := decodeMessage(b, func(field int, v uint64, b []byte) error {
+				switch field {
+				case sampleLocationID:
+					return decodeRepeated(v, b, func(v uint64) { s.locations = append(s.locations, v) })
+				case sampleValue:
+					return decodeRepeated(v, b, func(v uint64) { s.values = append(s.values, int64(v)) })
+				case sampleLabel:
+					l := label{sample: len(p.samples)}
+					err := decodeMessage(b, func(field int, v uint64, b []byte) error {
+						switch field {
+						case labelKey:
+							l.key = int64(v)
+						case labelNum:
+							l.num = int64(v)
+						}
+						return nil
+					})
+					labels = append(labels, l)
+					return err
+				}
+				return nil
+			})
+			p.samples = append(p.samples, s)
+			return err
+		case profileLocation:
+			var id uint64
+			var fns []uint64
+			err := decodeMessage(b, func(field int, v uint64, b []byte) error {
+				switch field {
+				case locationID:
+					id = v
+				case locationLine:
+					return decodeMessage(b, func(field int, v uint64, b []byte) error {
+						if field == lineFunctionID {
+							fns = append(fns, v)
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+			p.locations[id] = fns
+			return err
+		case profileFunction:
+			var id uint64
+			var name int64
+			err := decodeMessage(b, func(field int, v uint64, b []byte) error {
+				switch field {
+				case functionID:
+					id = v
+				case functionName:
+					name = int64(v)
+				}
+				return nil
+			})
+			p.functions[id] = name
+			return err
+		case profileStringTable:
+			p.strings = append(p.strings, string(b))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range labels {
+		if p.str(l.key) == "bytes" {
+			p.samples[l.sample].bytes = l.num
+		}
+	}
+	return p, nil
+}
+
+// decodeMessage calls f for each field of the protocol buffer message
+// in data. For varint and fixed-size fields, f receives the value in
+// v and a nil b. For length-delimited fields, f receives the contents
+// in b.
+func decodeMessage(data []byte, f func(field int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := decodeVarint(data)
+		if n == 0 {
+			return errors.New("bad field key")
+		}
+		data = data[n:]
+		field, wire := int(key>>3), key&7
+		var v uint64
+		var b []byte
+		switch wire {
+		case 0: // Varint
+			v, n = decodeVarint(data)
+			if n == 0 {
+				return errors.New("bad varint")
+			}
+			data = data[n:]
+		case 1: // 64-bit
+			if len(data) < 8 {
+				return errors.New("truncated fixed64")
+			}
+			for i := 7; i >= 0; i-- {
+				v = v<<8 | uint64(data[i])
+			}
+			data = data[8:]
+		case 2: // Length-delimited
+			l, n := decodeVarint(data)
+			if n == 0 || l > uint64(len(data)-n) {
+				return errors.New("bad length")
+			}
+			b = data[n : n+int(l)]
+			data = data[n+int(l):]
+		case 5: // 32-bit
+			if len(data) < 4 {
+				return errors.New("truncated fixed32")
+			}
+			for i := 3; i >= 0; i-- {
+				v = v<<8 | uint64(data[i])
+			}
+			data = data[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %d", wire)
+		}
+		if err := f(field, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeRepeated calls f for each value of a repeated varint field,
+// which may be packed into b or a single value v.
+func decodeRepeated(v uint64, b []byte, f func(uint64)) error {
+	if b == nil {
+		f(v)
+		return nil
+	}
+	for len(b) > 0 {
+		v, n := decodeVarint(b)
+		if n == 0 {
+			return errors.New("bad packed varint")
+		}
+		f(v)
+		b = b[n:]
+	}
+	return nil
+}
+
+// decodeVarint decodes a varint from the beginning of b and returns
+// its value and length, or a length of 0 if b doesn't start with a
+// valid varint.
+func decodeVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * uint(i))
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapgen
+
+import (
+	"bytes"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+type profileTestObject struct {
+	p    *profileTestObject
+	data [11]int
+}
+
+var profileSink []interface{}
+
+func TestReadHeapProfile(t *testing.T) {
+	defer func(rate int) { runtime.MemProfileRate = rate }(runtime.MemProfileRate)
+	runtime.MemProfileRate = 1
+
+	const n = 1000
+	for i := 0; i < n; i++ {
+		profileSink = append(profileSink, new(profileTestObject), strings.Repeat("x", 8192))
+	}
+	// The heap profile reflects the last completed GC cycle.
+	runtime.GC()
+	var buf bytes.Buffer
+	if err := pprof.Lookup("heap").WriteTo(&buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	runtime.KeepAlive(profileSink)
+	profileSink = nil
+
+	p, err := ReadHeapProfile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var objs, strs int64
+	for _, c := range p.Classes {
+		switch {
+		case c.Size == 96 && !c.PointerFree:
+			objs += c.Objects
+		case c.Size == 8192 && c.PointerFree:
+			strs += c.Objects
+		}
+	}
+	if objs < n || strs < n {
+		t.Errorf("got %d 96-byte objects and %d 8192-byte pointer-free objects, want at least %d of each; classes: %+v", objs, strs, n, p.Classes)
+	}
+}
+
+func TestMakeProfileHeap(t *testing.T) {
+	p := &HeapProfile{Classes: []ObjectClass{
+		{Size: 64, Objects: 1000},
+		{Size: 1024, Objects: 100, PointerFree: true},
+		{Size: 1 << 20, Objects: 1},
+	}}
+	// The heap is 64000+102400+1048576 bytes, so at 1/10 scale
+	// the 1MB object appears in about 1 in 10 heaps.
+	const heaps = 200
+	large := 0
+	for seed := int64(0); seed < heaps; seed++ {
+		objs := MakeProfileHeap(p, int(p.Bytes()/10), 0.5, seed).([]unsafe.Pointer)
+		if len(objs) < 100 || len(objs) > 112 {
+			t.Fatalf("seed %d: got %d objects, want 110 or so", seed, len(objs))
+		}
+		if len(objs) == 111 {
+			large++
+		}
+	}
+	if large < heaps/20 || large > heaps/5 {
+		t.Errorf("1MB object in %d of %d heaps, want about %d", large, heaps, heaps/10)
+	}
+
+	// Objects have the right pointer density.
+	typ := objectType(ObjectClass{Size: 64}, 0.25)
+	if typ.Size() != 64 || typ.Field(0).Type.Len() != 2 {
+		t.Errorf("64-byte object with 1/4 pointers has type %v", typ)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapgen
+
+import (
+	"math"
+	"math/rand"
+)
+
+// MakeErdosRenyi constructs a random directed graph of objects with
+// the given number of nodes where each possible edge is present
+// independently with probability degree/nodes, so each node has on
+// average degree out-edges. The graph is a function of seed.
+//
+// A random graph isn't generally strongly connected, so the result
+// retains a slice of all of the nodes.
+func MakeErdosRenyi(nodes, degree int, seed int64) interface{} {
+	if nodes <= 0 || degree < 0 || degree > nodes {
+		panic("bad nodes or degree")
+	}
+	rng := rand.New(rand.NewSource(seed))
+	graph := make([]*graphNode, nodes)
+	for i := range graph {
+		graph[i] = new(graphNode)
+	}
+	if degree == 0 {
+		return graph
+	}
+	p := float64(degree) / float64(nodes)
+	logq := math.Log1p(-p)
+	var edges []*graphNode
+	for _, node := range graph {
+		// Rather than flipping a coin for every possible edge,
+		// skip ahead by geometrically distributed gaps between
+		// present edges (Batagelj and Brandes, 2005).
+		edges = edges[:0]
+		for w := -1; ; {
+			if p == 1 {
+				w++
+			} else {
+				w += 1 + int(math.Log(1-rng.Float64())/logq)
+			}
+			if w >= nodes || w < 0 {
+				break
+			}
+			edges = append(edges, graph[w])
+		}
+		node.edges = append([]*graphNode(nil), edges...)
+	}
+	return graph
+}
+
+// MakePowerLaw constructs a random directed graph of objects with the
+// given number of nodes by preferential attachment (Barabási and
+// Albert, 1999). Each node after the first has min(edges, i) edges to
+// distinct earlier nodes, chosen with probability proportional to
+// their degree, so the in-degrees follow a power law: most nodes have
+// few in-edges and a few hub nodes have very many. The graph is a
+// function of seed.
+//
+// The result retains a slice of all of the nodes.
+func MakePowerLaw(nodes, edges int, seed int64) interface{} {
+	if nodes <= 0 || nodes > math.MaxInt32 || edges < 1 {
+		panic("bad nodes or edges")
+	}
+	rng := rand.New(rand.NewSource(seed))
+	graph := make([]*graphNode, nodes)
+	// ends lists both endpoints of every edge, so choosing a
+	// uniformly random element chooses a node with probability
+	// proportional to its degree.
+	ends := make([]int32, 0, 2*nodes*edges)
+	var targets []int
+	for i := range graph {
+		n := edges
+		if i < n {
+			n = i
+		}
+		targets = targets[:0]
+	pick:
+		for len(targets) < n {
+			// Only the second node sees an empty ends.
+			j := 0
+			if len(ends) > 0 {
+				j = int(ends[rng.Intn(len(ends))])
+			}
+			for _, t := range targets {
+				if t == j {
+					continue pick
+				}
+			}
+			targets = append(targets, j)
+		}
+		node := &graphNode{make([]*graphNode, n)}
+		for k, j := range targets {
+			node.edges[k] = graph[j]
+			ends = append(ends, int32(i), int32(j))
+		}
+		graph[i] = node
+	}
+	return graph
+}
@@ -0,0 +1,268 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapgen
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// A shape is a named heap generator with integer parameters.
+type shape struct {
+	name   string
+	doc    string
+	params []param
+	make   func(args map[string]int) func(seed int64) interface{}
+
+	// check, if non-nil, validates combinations of parameters.
+	check func(args map[string]int) error
+
+	// parse, if non-nil, parses the param settings of spec in
+	// place of params and make, for shapes whose parameters
+	// aren't all integers. usage shows its parameters in
+	// ShapeHelp.
+	parse func(spec string, settings [][2]string) (func(seed int64) interface{}, error)
+	usage string
+}
+
+type param struct {
+	name     string
+	def, min int
+}
+
+// shapes is the registry of heap shapes, in the order they're
+// listed by ShapeHelp.
+var shapes = []*shape{
+	{
+		name: "AST",
+		doc:  "parsed ASTs of net/http (~1.8MB each)",
+		make: func(map[string]int) func(int64) interface{} {
+			return func(int64) interface{} { return MakeAST() }
+		},
+	},
+	{
+		name:   "deBruijn2",
+		doc:    "degree 2 de Bruijn graphs of 2**power nodes",
+		params: []param{{"power", 16, 0}},
+		make: func(args map[string]int) func(int64) interface{} {
+			return func(int64) interface{} { return MakeDeBruijn2(args["power"]) }
+		},
+		check: func(args map[string]int) error {
+			if math.Pow(2, float64(args["power"])) > math.MaxInt32 {
+				return fmt.Errorf("too many nodes")
+			}
+			return nil
+		},
+	},
+	{
+		name:   "deBruijn",
+		doc:    "de Bruijn graphs of degree**power nodes",
+		params: []param{{"degree", 4, 1}, {"power", 8, 0}},
+		make: func(args map[string]int) func(int64) interface{} {
+			return func(int64) interface{} { return MakeDeBruijn(args["degree"], args["power"]) }
+		},
+		check: func(args map[string]int) error {
+			if math.Pow(float64(args["degree"]), float64(args["power"])) > math.MaxInt32 {
+				return fmt.Errorf("too many nodes")
+			}
+			return nil
+		},
+	},
+	{
+		name:   "random",
+		doc:    "Erdős–Rényi random graphs with mean out-degree degree",
+		params: []param{{"nodes", 1 << 15, 1}, {"degree", 4, 0}, {"seed", 1, 0}},
+		make: func(args map[string]int) func(int64) interface{} {
+			return func(seed int64) interface{} {
+				return MakeErdosRenyi(args["nodes"], args["degree"], int64(args["seed"])+seed)
+			}
+		},
+		check: func(args map[string]int) error {
+			if args["degree"] > args["nodes"] {
+				return fmt.Errorf("degree exceeds nodes")
+			}
+			return nil
+		},
+	},
+	{
+		name:   "powerlaw",
+		doc:    "preferential attachment graphs with edges out-edges per node",
+		params: []param{{"nodes", 1 << 15, 1}, {"edges", 2, 1}, {"seed", 1, 0}},
+		make: func(args map[string]int) func(int64) interface{} {
+			return func(seed int64) interface{} {
+				return MakePowerLaw(args["nodes"], args["edges"], int64(args["seed"])+seed)
+			}
+		},
+	},
+	{
+		name:   "tree",
+		doc:    "complete binary trees",
+		params: []param{{"depth", 15, 0}},
+		make: func(args map[string]int) func(int64) interface{} {
+			return func(int64) interface{} { return MakeTree(args["depth"]) }
+		},
+		check: func(args map[string]int) error {
+			if math.Pow(2, float64(args["depth"]+1))-1 > math.MaxInt32 {
+				return fmt.Errorf("too many nodes")
+			}
+			return nil
+		},
+	},
+	{
+		name:   "list",
+		doc:    "singly linked lists",
+		params: []param{{"length", 1 << 16, 1}},
+		make: func(args map[string]int) func(int64) interface{} {
+			return func(int64) interface{} { return MakeList(args["length"]) }
+		},
+	},
+	{
+		name:   "map",
+		doc:    "maps with pointer values",
+		params: []param{{"entries", 1 << 13, 1}},
+		make: func(args map[string]int) func(int64) interface{} {
+			return func(int64) interface{} { return MakeMap(args["entries"]) }
+		},
+	},
+	{
+		name:   "fanout",
+		doc:    "slices of pointers to small objects",
+		params: []param{{"width", 1 << 16, 1}},
+		make: func(args map[string]int) func(int64) interface{} {
+			return func(int64) interface{} { return MakeFanout(args["width"]) }
+		},
+	},
+	{
+		name:   "blob",
+		doc:    "pointer-free byte slices",
+		params: []param{{"count", 16, 1}, {"size", 64 << 10, 1}},
+		make: func(args map[string]int) func(int64) interface{} {
+			return func(int64) interface{} { return MakeBlobs(args["count"], args["size"]) }
+		},
+	},
+	{
+		name:  "pprof",
+		doc:   "heaps like the in-use heap of pprof heap profile F",
+		usage: "pprof:file=F,size=1048576,ptrfrac=0.5",
+		parse: profileShape,
+	},
+}
+
+// Shape returns the heap generator described by spec, which can be
+// passed to Measure. spec is a shape name optionally followed by a
+// colon and a comma-separated list of param=value settings, such as
+// "tree" or "tree:depth=10". Parameters that aren't set take their
+// default values. ShapeHelp describes the available shapes.
+func Shape(spec string) (func() interface{}, error) {
+	gen, err := SeededShape(spec)
+	if err != nil {
+		return nil, err
+	}
+	return func() interface{} { return gen(0) }, nil
+}
+
+// SeededShape is like Shape, but returns a generator that can be
+// passed to GenerateSeeded. Shapes that are random graphs add the seed
+// passed to the generator to their seed parameter. Other shapes
+// ignore it.
+func SeededShape(spec string) (func(seed int64) interface{}, error) {
+	name, settings, err := parseSpec(spec)
+	if err != nil {
+		return nil, fmt.Errorf("heap shape %q: %v", spec, err)
+	}
+	var s *shape
+	for _, s1 := range shapes {
+		if s1.name == name {
+			s = s1
+			break
+		}
+	}
+	if s == nil {
+		return nil, fmt.Errorf("unknown heap shape %q", name)
+	}
+	if s.parse != nil {
+		return s.parse(spec, settings)
+	}
+
+	args := make(map[string]int)
+	for _, p := range s.params {
+		args[p.name] = p.def
+	}
+	for _, setting := range settings {
+		k, v := setting[0], setting[1]
+		var p *param
+		for i := range s.params {
+			if s.params[i].name == k {
+				p = &s.params[i]
+			}
+		}
+		if p == nil {
+			return nil, fmt.Errorf("heap shape %q: unknown param %q", spec, k)
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < p.min {
+			return nil, fmt.Errorf("heap shape %q: bad value %q for %s", spec, v, k)
+		}
+		args[k] = n
+	}
+	if s.check != nil {
+		if err := s.check(args); err != nil {
+			return nil, fmt.Errorf("heap shape %q: %v", spec, err)
+		}
+	}
+	return s.make(args), nil
+}
+
+// parseSpec splits a generator spec of the form
+// "name[:param=value,...]" into its name and param settings.
+func parseSpec(spec string) (name string, settings [][2]string, err error) {
+	name, rest := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		name, rest = spec[:i], spec[i+1:]
+	}
+	if rest == "" {
+		return name, nil, nil
+	}
+	for _, setting := range strings.Split(rest, ",") {
+		i := strings.Index(setting, "=")
+		if i < 0 {
+			return "", nil, fmt.Errorf("expected param=value, got %q", setting)
+		}
+		settings = append(settings, [2]string{setting[:i], setting[i+1:]})
+	}
+	return name, settings, nil
+}
+
+// ShapeHelp returns a description of the heap shapes accepted by
+// Shape, one per line, for use in command help. Each line shows the
+// shape's parameters with their default values.
+func ShapeHelp() string {
+	var specs []string
+	width := 0
+	for _, s := range shapes {
+		spec := s.name
+		if s.usage != "" {
+			spec = s.usage
+		}
+		for i, p := range s.params {
+			sep := ","
+			if i == 0 {
+				sep = ":"
+			}
+			spec += fmt.Sprintf("%s%s=%d", sep, p.name, p.def)
+		}
+		specs = append(specs, spec)
+		if len(spec) > width {
+			width = len(spec)
+		}
+	}
+	var lines []string
+	for i, s := range shapes {
+		lines = append(lines, fmt.Sprintf("%-*s  %s", width, specs[i], s.doc))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,111 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapgen
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShape(t *testing.T) {
+	for _, s := range shapes {
+		if s.parse != nil {
+			// Custom shapes may have required params.
+			continue
+		}
+		if _, err := Shape(s.name); err != nil {
+			t.Errorf("Shape(%q): %v", s.name, err)
+		}
+	}
+
+	gen, err := Shape("tree:depth=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count func(n *treeNode) int
+	count = func(n *treeNode) int {
+		if n == nil {
+			return 0
+		}
+		return 1 + count(n.left) + count(n.right)
+	}
+	if n := count(gen().(*treeNode)); n != 15 {
+		t.Errorf("tree:depth=3 has %d nodes, want 15", n)
+	}
+
+	gen, err = Shape("blob:size=10,count=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blobs := gen().([][]byte); len(blobs) != 3 || len(blobs[0]) != 10 {
+		t.Errorf("blob:size=10,count=3 has %d blobs of %d bytes, want 3 of 10", len(blobs), len(blobs[0]))
+	}
+
+	// Random graphs are a function of their seed.
+	for _, spec := range []string{"random:nodes=100,seed=2", "powerlaw:nodes=100,edges=3,seed=2"} {
+		gen, err := Shape(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, b := edgeList(gen()), edgeList(gen()); !reflect.DeepEqual(a, b) {
+			t.Errorf("%s: graphs differ with the same seed", spec)
+		}
+	}
+
+	for spec, want := range map[string]string{
+		"cube":               "unknown heap shape",
+		"tree:width=1":       "unknown param",
+		"tree:depth":         "param=value",
+		"list:length=0":      "bad value",
+		"list:length=x":      "bad value",
+		"AST:power=1":        "unknown param",
+		"tree:depth=2,foo=":  "unknown param",
+		"random:nodes=2":     "degree exceeds nodes",
+		"deBruijn:power=30":  "too many nodes",
+		"deBruijn2:power=31": "too many nodes",
+		"deBruijn2:power=63": "too many nodes",
+		"tree:depth=31":      "too many nodes",
+		"tree:depth=63":      "too many nodes",
+		"pprof":              "missing file param",
+		"pprof:size=0":       "bad value",
+		"pprof:depth=1":      "unknown param",
+	} {
+		_, err := Shape(spec)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Shape(%q): want error containing %q, got %v", spec, want, err)
+		}
+	}
+}
+
+func TestShapeHelp(t *testing.T) {
+	help := ShapeHelp()
+	lines := strings.Split(help, "\n")
+	if len(lines) != len(shapes) {
+		t.Errorf("ShapeHelp has %d lines, want one for each of %d shapes", len(lines), len(shapes))
+	}
+	for _, want := range []string{"tree:depth=15 ", "pprof:file=F,size=1048576,ptrfrac=0.5 "} {
+		if !strings.Contains(help, want) {
+			t.Errorf("ShapeHelp does not contain %q:\n%s", want, help)
+		}
+	}
+}
+
+// edgeList returns the edges of a graph retained by a []*graphNode as
+// pairs of node indexes.
+func edgeList(g interface{}) [][2]int {
+	nodes := g.([]*graphNode)
+	index := make(map[*graphNode]int)
+	for i, n := range nodes {
+		index[n] = i
+	}
+	var edges [][2]int
+	for i, n := range nodes {
+		for _, e := range n.edges {
+			edges = append(edges, [2]int{i, index[e]})
+		}
+	}
+	return edges
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapgen
+
+import (
+	"runtime"
+	"runtime/metrics"
+)
+
+// heapStats is a snapshot of the heap statistics Measure uses.
+type heapStats struct {
+	// inuseBytes is the bytes in in-use heap spans.
+	inuseBytes int64
+
+	// objectBytes and objects are the bytes and number of heap
+	// objects that haven't been freed.
+	objectBytes, objects int64
+
+	// scanBytes is the scannable bytes of heap as of the last GC,
+	// or -1 if the runtime doesn't report it.
+	scanBytes int64
+
+	// allocBytes and allocs are the cumulative bytes and number
+	// of heap objects allocated.
+	allocBytes, allocs int64
+
+	// gcs is the number of completed GC cycles.
+	gcs int64
+}
+
+// heapMetrics lists the runtime/metrics readHeapStats reads, along
+// with the field each one sets. Optional metrics have no equivalent
+// in runtime.MemStats.
+var heapMetrics = []struct {
+	name     string
+	field    func(*heapStats) *int64
+	optional bool
+}{
+	{"/memory/classes/heap/objects:bytes", func(s *heapStats) *int64 { return &s.objectBytes }, false},
+	{"/memory/classes/heap/unused:bytes", func(s *heapStats) *int64 { return &s.inuseBytes }, false},
+	{"/gc/heap/objects:objects", func(s *heapStats) *int64 { return &s.objects }, false},
+	{"/gc/scan/heap:bytes", func(s *heapStats) *int64 { return &s.scanBytes }, true},
+	{"/gc/heap/allocs:bytes", func(s *heapStats) *int64 { return &s.allocBytes }, false},
+	{"/gc/heap/allocs:objects", func(s *heapStats) *int64 { return &s.allocs }, false},
+	{"/gc/cycles/total:gc-cycles", func(s *heapStats) *int64 { return &s.gcs }, false},
+}
+
+var heapSamples = func() []metrics.Sample {
+	samples := make([]metrics.Sample, len(heapMetrics))
+	for i, m := range heapMetrics {
+		samples[i].Name = m.name
+	}
+	return samples
+}()
+
+// readHeapStats returns the current heap statistics. It reads them
+// from runtime/metrics if the runtime supports all of the metrics
+// and otherwise falls back to runtime.MemStats.
+//
+// readHeapStats doesn't allocate, so it doesn't perturb the statistics
+// it reads, but it must not be called concurrently.
+func readHeapStats() heapStats {
+	samples := heapSamples
+	metrics.Read(samples)
+
+	var s heapStats
+	ok := true
+	for i, m := range heapMetrics {
+		if samples[i].Value.Kind() != metrics.KindUint64 {
+			if m.optional {
+				*m.field(&s) = -1
+			} else {
+				ok = false
+			}
+			continue
+		}
+		*m.field(&s) = int64(samples[i].Value.Uint64())
+	}
+	if ok {
+		// In-use spans hold both objects and unused space.
+		s.inuseBytes += s.objectBytes
+		return s
+	}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return heapStats{
+		inuseBytes:  int64(ms.HeapInuse),
+		objectBytes: int64(ms.HeapAlloc),
+		objects:     int64(ms.HeapObjects),
+		scanBytes:   s.scanBytes,
+		allocBytes:  int64(ms.TotalAlloc),
+		allocs:      int64(ms.Mallocs),
+		gcs:         int64(ms.NumGC),
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapgen
+
+type treeNode struct {
+	left, right *treeNode
+}
+
+// MakeTree constructs a complete binary tree of objects of the given
+// depth. The tree has 2**(depth+1)-1 nodes, each with two pointers,
+// so the mark work available in parallel doubles at each level.
+func MakeTree(depth int) interface{} {
+	if depth < 0 || depth >= 63 {
+		panic("bad depth")
+	}
+	var build func(depth int) *treeNode
+	build = func(depth int) *treeNode {
+		n := new(treeNode)
+		if depth > 0 {
+			n.left = build(depth - 1)
+			n.right = build(depth - 1)
+		}
+		return n
+	}
+	return build(depth)
+}
@@ -0,0 +1,387 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcbench
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// Plot geometry, in pixels.
+const (
+	plotWidth  = 800
+	plotHeight = 200
+	plotMargin = 60 // Left margin for Y labels
+	plotPad    = 30 // Space for X labels
+)
+
+// WriteHTMLReport writes a self-contained HTML page visualizing r to
+// w. The page shows r's metrics, a log-log histogram of each latency
+// distribution, a timeline of GC cycles and their phases, the heap
+// size and goal over time, GC CPU utilization, and the tail latency
+// of each latency series over time. It uses only inline SVG and CSS,
+// so it can be viewed without network access.
+func WriteHTMLReport(w io.Writer, r *RunResult) error {
+	bw := bufio.NewWriter(w)
+	p := &htmlWriter{w: bw}
+
+	p.printf(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>%s</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td { padding: 0 1em 0 0; }
+td.num { text-align: right; font-family: monospace; }
+svg { display: block; margin-bottom: 2em; }
+svg text { font-size: 11px; }
+.axis { stroke: #000; }
+.grid { stroke: #ddd; }
+.stw { fill: #d62728; }
+.mark { fill: #1f77b4; }
+.phase { stroke: #2ca02c; stroke-dasharray: 4 2; }
+</style></head><body>
+`, html.EscapeString(r.Name))
+	p.printf("<h1>%s</h1>\n", html.EscapeString(r.Name))
+
+	// Metrics table.
+	p.printf("<h2>Metrics</h2>\n<table>\n")
+	units := make([]string, 0, len(r.Result))
+	for unit := range r.Result {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+	for _, unit := range units {
+		p.printf("<tr><td class=\"num\">%s</td><td>%s</td></tr>\n", sigfigs(r.Result[unit]), html.EscapeString(unit))
+	}
+	p.printf("</table>\n")
+
+	// Latency histograms.
+	names := make([]string, 0, len(r.Latency))
+	for name := range r.Latency {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p.printf("<h2>Latency distribution: %s</h2>\n", html.EscapeString(name))
+		p.latencyHist(r.Latency[name])
+	}
+
+	// GC timelines.
+	if len(r.Trace) > 0 {
+		end := r.Trace[len(r.Trace)-1].End
+		for _, s := range r.LatencySeries {
+			ivs := s.Intervals(nil)
+			if len(ivs) > 0 && ivs[len(ivs)-1].Start+s.Interval > end {
+				end = ivs[len(ivs)-1].Start + s.Interval
+			}
+		}
+		x := linearAxis(0, float64(end), plotMargin, plotMargin+plotWidth)
+
+		p.printf("<h2>GC cycles</h2>\n")
+		p.gcTimeline(r.Trace, r.Phases, x)
+		p.printf("<h2>Heap size</h2>\n")
+		p.heapPlot(r.Trace, r.Phases, x)
+		p.printf("<h2>GC CPU utilization</h2>\n")
+		p.utilStrip(r.Trace, r.Phases, x)
+
+		names = names[:0]
+		for name := range r.LatencySeries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p.printf("<h2>Latency over time: %s</h2>\n", html.EscapeString(name))
+			p.seriesPlot(r.LatencySeries[name], r.Trace, r.Phases, x)
+		}
+	}
+
+	p.printf("</body></html>\n")
+	if p.err != nil {
+		return p.err
+	}
+	return bw.Flush()
+}
+
+type htmlWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *htmlWriter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+// axis maps data values to pixel coordinates.
+type axis struct {
+	lo, hi       float64 // Data range
+	pxLo, pxHi   float64 // Pixel range
+	log          bool
+	logLo, logHi float64
+}
+
+func linearAxis(lo, hi, pxLo, pxHi float64) *axis {
+	if hi <= lo {
+		hi = lo + 1
+	}
+	return &axis{lo: lo, hi: hi, pxLo: pxLo, pxHi: pxHi}
+}
+
+func logAxis(lo, hi, pxLo, pxHi float64) *axis {
+	if hi <= lo {
+		hi = lo * 10
+	}
+	return &axis{lo: lo, hi: hi, pxLo: pxLo, pxHi: pxHi, log: true, logLo: math.Log10(lo), logHi: math.Log10(hi)}
+}
+
+// px returns the pixel coordinate of v, clamped to the axis.
+func (a *axis) px(v float64) float64 {
+	var frac float64
+	if a.log {
+		if v <= a.lo {
+			frac = 0
+		} else {
+			frac = (math.Log10(v) - a.logLo) / (a.logHi - a.logLo)
+		}
+	} else {
+		frac = (v - a.lo) / (a.hi - a.lo)
+	}
+	if frac < 0 {
+		frac = 0
+	} else if frac > 1 {
+		frac = 1
+	}
+	return a.pxLo + frac*(a.pxHi-a.pxLo)
+}
+
+// ticks returns tick values for a. Log axes get a tick at each power
+// of 10. Linear axes get about n ticks at round values.
+func (a *axis) ticks(n int) []float64 {
+	var out []float64
+	if a.log {
+		for e := math.Ceil(a.logLo); e <= a.logHi; e++ {
+			out = append(out, math.Pow(10, e))
+		}
+		return out
+	}
+	step := math.Pow(10, math.Floor(math.Log10((a.hi-a.lo)/float64(n))))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if (a.hi-a.lo)/(step*m) <= float64(n) {
+			step *= m
+			break
+		}
+	}
+	for v := math.Ceil(a.lo/step) * step; v <= a.hi; v += step {
+		out = append(out, v)
+	}
+	return out
+}
+
+// svgStart starts an SVG plot with X axis x and an optional Y axis y.
+// Tick labels are formatted with xLabel and yLabel.
+func (p *htmlWriter) svgStart(height float64, x, y *axis, xLabel, yLabel func(float64) string) {
+	p.printf("<svg width=\"%d\" height=\"%g\" xmlns=\"http://www.w3.org/2000/svg\">\n", plotMargin+plotWidth+20, height+plotPad)
+	for _, t := range x.ticks(10) {
+		px := x.px(t)
+		p.printf("<line class=\"grid\" x1=\"%.1f\" y1=\"0\" x2=\"%.1f\" y2=\"%g\"/>\n", px, px, height)
+		p.printf("<text x=\"%.1f\" y=\"%g\" text-anchor=\"middle\">%s</text>\n", px, height+15, html.EscapeString(xLabel(t)))
+	}
+	if y != nil {
+		for _, t := range y.ticks(5) {
+			py := y.px(t)
+			p.printf("<line class=\"grid\" x1=\"%d\" y1=\"%.1f\" x2=\"%d\" y2=\"%.1f\"/>\n", plotMargin, py, plotMargin+plotWidth, py)
+			p.printf("<text x=\"%d\" y=\"%.1f\" text-anchor=\"end\">%s</text>\n", plotMargin-4, py+4, html.EscapeString(yLabel(t)))
+		}
+	}
+	p.printf("<line class=\"axis\" x1=\"%d\" y1=\"%g\" x2=\"%d\" y2=\"%g\"/>\n", plotMargin, height, plotMargin+plotWidth, height)
+	p.printf("<line class=\"axis\" x1=\"%d\" y1=\"0\" x2=\"%d\" y2=\"%g\"/>\n", plotMargin, plotMargin, height)
+}
+
+// phaseMarkers draws a vertical line at the start of each phase.
+func (p *htmlWriter) phaseMarkers(phases []Phase, x *axis, height float64) {
+	for _, ph := range phases {
+		px := x.px(float64(ph.Start))
+		p.printf("<line class=\"phase\" x1=\"%.1f\" y1=\"0\" x2=\"%.1f\" y2=\"%g\"><title>%s</title></line>\n", px, px, height, html.EscapeString(ph.Name))
+		p.printf("<text x=\"%.1f\" y=\"10\" fill=\"#2ca02c\">%s</text>\n", px+2, html.EscapeString(ph.Name))
+	}
+}
+
+func durLabel(v float64) string {
+	return time.Duration(v).String()
+}
+
+func bytesLabel(v float64) string {
+	return fmt.Sprintf("%gMB", v/1e6)
+}
+
+// latencyHist plots d as a histogram with log latency and log count
+// axes.
+func (p *htmlWriter) latencyHist(d *LatencyDist) {
+	minb, maxb, any := d.bounds()
+	if !any {
+		p.printf("<p>no samples</p>\n")
+		return
+	}
+	lo, _ := d.FromBucket(minb)
+	_, hi := d.FromBucket(maxb - 1)
+	if lo <= 0 {
+		lo = d.lo / 10
+	}
+	var maxCount int64
+	for _, count := range d.Buckets {
+		if count > maxCount {
+			maxCount = count
+		}
+	}
+	x := logAxis(float64(lo), float64(hi), plotMargin, plotMargin+plotWidth)
+	y := logAxis(0.5, float64(maxCount)*2, plotHeight, 0)
+	p.svgStart(plotHeight, x, y, durLabel, func(v float64) string { return fmt.Sprint(v) })
+	for b := minb; b < maxb; b++ {
+		count := d.Buckets[b]
+		if count == 0 {
+			continue
+		}
+		blo, bhi := d.FromBucket(b)
+		if blo <= 0 {
+			blo = lo
+		}
+		x1, x2 := x.px(float64(blo)), x.px(float64(bhi))
+		top := y.px(float64(count))
+		p.printf("<rect class=\"mark\" x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\"><title>[%s, %s): %d</title></rect>\n", x1, top, math.Max(x2-x1, 1), plotHeight-top, blo, bhi, count)
+	}
+	p.printf("</svg>\n")
+}
+
+// gcTimeline plots each GC cycle as a bar broken into its STW and
+// concurrent phases.
+func (p *htmlWriter) gcTimeline(trace GCTrace, phases []Phase, x *axis) {
+	const height = 40
+	p.svgStart(height, x, nil, durLabel, nil)
+	for _, c := range trace {
+		// Concurrent phases span the whole cycle; STW phases
+		// are drawn on top. STW phases are often much shorter
+		// than a pixel, so give them a minimum width.
+		x1, x2 := x.px(float64(c.Start)), x.px(float64(c.End))
+		title := fmt.Sprintf("GC %d: sweep term %s, mark %s, mark term %s", c.N, c.ClockSweepTerm, c.ClockRootScan+c.ClockSync+c.ClockMark, c.ClockMarkTerm)
+		if c.Forced {
+			title += " (forced)"
+		}
+		p.printf("<g><title>%s</title>\n", html.EscapeString(title))
+		p.printf("<rect class=\"mark\" x=\"%.1f\" y=\"10\" width=\"%.1f\" height=\"20\"/>\n", x1, math.Max(x2-x1, 1))
+		sweepEnd := x.px(float64(c.Start + c.ClockSweepTerm))
+		p.printf("<rect class=\"stw\" x=\"%.1f\" y=\"10\" width=\"%.1f\" height=\"20\"/>\n", x1, math.Max(sweepEnd-x1, 1))
+		markTermStart := x.px(float64(c.End - c.ClockMarkTerm))
+		p.printf("<rect class=\"stw\" x=\"%.1f\" y=\"10\" width=\"%.1f\" height=\"20\"/>\n", markTermStart, math.Max(x2-markTermStart, 1))
+		p.printf("</g>\n")
+	}
+	p.phaseMarkers(phases, x, height)
+	p.printf("</svg>\n")
+}
+
+// heapPlot plots the heap size, goal, and marked heap of each GC
+// cycle over time.
+func (p *htmlWriter) heapPlot(trace GCTrace, phases []Phase, x *axis) {
+	var maxHeap Bytes
+	for _, c := range trace {
+		for _, b := range []Bytes{c.HeapActual, c.HeapGoal, c.HeapTrigger} {
+			if b > maxHeap {
+				maxHeap = b
+			}
+		}
+	}
+	y := linearAxis(0, float64(maxHeap)*1.1, plotHeight, 0)
+	p.svgStart(plotHeight, x, y, durLabel, bytesLabel)
+
+	// The heap grows from the trigger at the start of each cycle
+	// to its actual size at the end, then drops to the marked
+	// heap after sweeping.
+	p.printf("<polyline fill=\"none\" stroke=\"#1f77b4\" points=\"")
+	for _, c := range trace {
+		p.printf("%.1f,%.1f %.1f,%.1f %.1f,%.1f ", x.px(float64(c.Start)), y.px(float64(c.HeapTrigger)), x.px(float64(c.End)), y.px(float64(c.HeapActual)), x.px(float64(c.End)), y.px(float64(c.HeapMarked)))
+	}
+	p.printf("\"><title>heap size</title></polyline>\n")
+	p.printf("<polyline fill=\"none\" stroke=\"#d62728\" stroke-dasharray=\"4 2\" points=\"")
+	for _, c := range trace {
+		p.printf("%.1f,%.1f %.1f,%.1f ", x.px(float64(c.Start)), y.px(float64(c.HeapGoal)), x.px(float64(c.End)), y.px(float64(c.HeapGoal)))
+	}
+	p.printf("\"><title>heap goal</title></polyline>\n")
+	p.phaseMarkers(phases, x, plotHeight)
+	p.printf("<text x=\"%d\" y=\"12\" fill=\"#1f77b4\">heap</text>", plotMargin+plotWidth-80)
+	p.printf("<text x=\"%d\" y=\"12\" fill=\"#d62728\">goal</text>", plotMargin+plotWidth-40)
+	p.printf("</svg>\n")
+}
+
+// utilStrip shows the fraction of CPU used by GC during each cycle's
+// concurrent mark phase as the darkness of a strip.
+func (p *htmlWriter) utilStrip(trace GCTrace, phases []Phase, x *axis) {
+	const height = 30
+	p.svgStart(height, x, nil, durLabel, nil)
+	for _, c := range trace {
+		if c.ClockMark == 0 || c.Procs == 0 {
+			continue
+		}
+		util := float64(c.CPUAssist+c.CPUBackground) / (float64(c.ClockMark) * float64(c.Procs))
+		if util > 1 {
+			util = 1
+		}
+		x1, x2 := x.px(float64(c.Start)), x.px(float64(c.End))
+		p.printf("<rect x=\"%.1f\" y=\"5\" width=\"%.1f\" height=\"20\" fill=\"#ff7f0e\" fill-opacity=\"%.2f\"><title>GC %d: %.0f%% (assist %s, background %s)</title></rect>\n", x1, math.Max(x2-x1, 1), util, c.N, util*100, c.CPUAssist, c.CPUBackground)
+	}
+	p.phaseMarkers(phases, x, height)
+	p.printf("</svg>\n")
+}
+
+// seriesPlot plots the 99th percentile and maximum latency of each
+// interval of s over time, with GC cycles shaded.
+func (p *htmlWriter) seriesPlot(s *LatencySeries, trace GCTrace, phases []Phase, x *axis) {
+	ivs := s.Intervals(nil)
+	if len(ivs) == 0 {
+		p.printf("<p>no samples</p>\n")
+		return
+	}
+	lo, hi := ivs[0].Dist.Quantile(0.99), time.Duration(0)
+	for _, iv := range ivs {
+		if q := iv.Dist.Quantile(0.99); q < lo {
+			lo = q
+		}
+		if iv.Dist.Max > hi {
+			hi = iv.Dist.Max
+		}
+	}
+	if lo <= 0 {
+		lo = 1
+	}
+	y := logAxis(float64(lo)/2, float64(hi)*2, plotHeight, 0)
+	p.svgStart(plotHeight, x, y, durLabel, durLabel)
+	for _, c := range trace {
+		x1, x2 := x.px(float64(c.Start)), x.px(float64(c.End))
+		p.printf("<rect x=\"%.1f\" y=\"0\" width=\"%.1f\" height=\"%d\" fill=\"#1f77b4\" fill-opacity=\"0.15\"/>\n", x1, math.Max(x2-x1, 1), plotHeight)
+	}
+	for _, line := range []struct {
+		name, color string
+		q           float64
+	}{{"P99", "#ff7f0e", 0.99}, {"max", "#d62728", 1}} {
+		p.printf("<polyline fill=\"none\" stroke=\"%s\" points=\"", line.color)
+		for _, iv := range ivs {
+			v := iv.Dist.Max
+			if line.q < 1 {
+				v = iv.Dist.Quantile(line.q)
+			}
+			p.printf("%.1f,%.1f ", x.px(float64(iv.Start+s.Interval/2)), y.px(float64(v)))
+		}
+		p.printf("\"><title>%s</title></polyline>\n", line.name)
+	}
+	p.phaseMarkers(phases, x, plotHeight)
+	p.printf("<text x=\"%d\" y=\"12\" fill=\"#ff7f0e\">P99</text>", plotMargin+plotWidth-80)
+	p.printf("<text x=\"%d\" y=\"12\" fill=\"#d62728\">max</text>", plotMargin+plotWidth-40)
+	p.printf("</svg>\n")
+}
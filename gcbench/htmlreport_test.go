@@ -0,0 +1,84 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcbench
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteHTMLReport(t *testing.T) {
+	lat := new(LatencyDist)
+	for i := 1; i <= 100; i++ {
+		lat.Add(time.Duration(i) * 10 * time.Microsecond)
+	}
+	series := NewLatencySeries(10*time.Millisecond, 100)
+	for i := 0; i < 10; i++ {
+		series.AddAt(processStart.Add(time.Duration(i)*10*time.Millisecond), time.Duration(i+1)*time.Millisecond)
+	}
+	r := &RunResult{
+		Name:    "BenchmarkTest/x:<y>",
+		Result:  map[string]float64{"GCs/op": 2, "P99-latency-ns": 990000},
+		Latency: map[string]*LatencyDist{"latency": lat},
+		LatencySeries: map[string]*LatencySeries{
+			"server-latency": series,
+		},
+		Trace: GCTrace{
+			{N: 1, Start: 10 * time.Millisecond, End: 20 * time.Millisecond, ClockSweepTerm: time.Millisecond, ClockMark: 8 * time.Millisecond, ClockMarkTerm: time.Millisecond, HeapTrigger: 4 * MB, HeapActual: 5 * MB, HeapMarked: 2 * MB, HeapGoal: 5 * MB, Procs: 1, Util: 0.1},
+			{N: 2, Start: 60 * time.Millisecond, End: 75 * time.Millisecond, ClockSweepTerm: time.Millisecond, ClockMark: 13 * time.Millisecond, ClockMarkTerm: time.Millisecond, HeapTrigger: 4 * MB, HeapActual: 6 * MB, HeapMarked: 3 * MB, HeapGoal: 5 * MB, Procs: 1, Util: 0.2},
+		},
+		Phases: []Phase{{"warm<up>", 0}, {"steady", 50 * time.Millisecond}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteHTMLReport(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"<h1>BenchmarkTest/x:&lt;y&gt;</h1>",
+		"<h2>Metrics</h2>",
+		"P99-latency-ns",
+		"<h2>Latency distribution: latency</h2>",
+		"<h2>GC cycles</h2>",
+		"<h2>Heap size</h2>",
+		"<h2>GC CPU utilization</h2>",
+		"<h2>Latency over time: server-latency</h2>",
+		`class="stw"`,
+		"<title>warm&lt;up&gt;</title>",
+		"</body></html>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report does not contain %q", want)
+		}
+	}
+	// One plot for the latency histogram and four timelines.
+	if n, m := strings.Count(out, "<svg"), strings.Count(out, "</svg>"); n != 5 || m != 5 {
+		t.Errorf("report has %d <svg> and %d </svg>, want 5", n, m)
+	}
+	if strings.Contains(out, "NaN") || strings.Contains(out, "Inf") {
+		t.Errorf("report contains a NaN or Inf coordinate")
+	}
+
+	// Without a trace, there are no timelines.
+	buf.Reset()
+	if err := WriteHTMLReport(&buf, &RunResult{Name: "BenchmarkEmpty", Result: map[string]float64{}}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "<svg") {
+		t.Errorf("report without a trace or latency has plots")
+	}
+
+	if err := WriteHTMLReport(errWriter{}, r); err == nil {
+		t.Errorf("write error: want error")
+	}
+}
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) { return 0, errors.New("write failed") }
@@ -5,30 +5,172 @@
 package gcbench
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"math"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 // LatencyDist records a distribution of latencies in exponential
-// buckets between 1 ns and 1 sec.
+// buckets.
+//
+// The buckets cover a configurable range with a bounded relative
+// error, in the style of HDR histograms: each bucket spans a ratio of
+// 1+relErr, so any value reported by Quantile is within relErr of a
+// sample in that bucket. Latencies below the range are recorded in an
+// underflow bucket and latencies above it in an overflow bucket, so no
+// samples are lost, but quantiles in these buckets are less precise.
+//
+// The zero value is an empty distribution with the default range of
+// 100ns to 1 minute and 1% relative error. Use NewLatencyDist for a
+// different range or resolution.
 type LatencyDist struct {
 	N       int64
 	Max     time.Duration
-	Buckets [256]int64
+	Buckets []int64
+
+	// Bucket 0 is [0, lo), buckets 1 through len(Buckets)-2
+	// divide [lo, hi) into exponential buckets, and the last
+	// bucket is [hi, ∞).
+	lo, hi time.Duration
+	relErr float64
+
+	// logLo is log(lo) and logRatio is the log of the ratio
+	// between successive bucket boundaries.
+	logLo, logRatio float64
+
+	init sync.Once
+}
+
+const (
+	defaultLatencyMin    = 100 * time.Nanosecond
+	defaultLatencyMax    = time.Minute
+	defaultLatencyRelErr = 0.01
+)
+
+// NewLatencyDist returns an empty LatencyDist with exponential
+// buckets between min and max and at most relErr relative error.
+func NewLatencyDist(min, max time.Duration, relErr float64) *LatencyDist {
+	d := new(LatencyDist)
+	d.init.Do(func() { d.setLayout(min, max, relErr) })
+	return d
+}
+
+func (d *LatencyDist) setLayout(min, max time.Duration, relErr float64) {
+	if min <= 0 || max <= min || relErr <= 0 {
+		panic(fmt.Sprintf("bad LatencyDist layout [%s, %s) ±%g", min, max, relErr))
+	}
+	d.lo, d.hi, d.relErr = min, max, relErr
+	d.logLo = math.Log(float64(min))
+	d.logRatio = math.Log1p(relErr)
+	d.Buckets = make([]int64, int(numBuckets(min, max, relErr)))
+}
+
+// maxLatencyBuckets bounds the number of buckets in a decoded
+// LatencyDist, so a corrupt layout can't force a huge allocation.
+// The default layout uses about 2,000.
+const maxLatencyBuckets = 1 << 20
+
+// numBuckets returns the number of buckets in the layout [min, max)
+// ±relErr, including the underflow and overflow buckets.
+func numBuckets(min, max time.Duration, relErr float64) float64 {
+	return math.Ceil(math.Log(float64(max)/float64(min))/math.Log1p(relErr)) + 2
+}
+
+// layout initializes d's bucket layout if it is the zero
+// LatencyDist.
+func (d *LatencyDist) layout() {
+	d.init.Do(func() {
+		d.setLayout(defaultLatencyMin, defaultLatencyMax, defaultLatencyRelErr)
+	})
 }
 
-const latencyMax = time.Second
+// empty returns an empty LatencyDist with the same layout as d.
+func (d *LatencyDist) empty() *LatencyDist {
+	d.layout()
+	return NewLatencyDist(d.lo, d.hi, d.relErr)
+}
+
+// sameLayout returns whether d and o have the same bucket layout.
+func (d *LatencyDist) sameLayout(o *LatencyDist) bool {
+	d.layout()
+	o.layout()
+	return d.lo == o.lo && d.hi == o.hi && d.relErr == o.relErr
+}
 
 func (d *LatencyDist) Start() *LatencyTracker {
 	return &LatencyTracker{dist: d, last: time.Now()}
 }
 
+// StartCorrected is like Start, but the returned tracker also
+// records each latency into corrected using AddCorrected with the
+// given expected interval.
+func (d *LatencyDist) StartCorrected(corrected *LatencyDist, interval time.Duration) *LatencyTracker {
+	return &LatencyTracker{dist: d, last: time.Now(), corrected: corrected, interval: interval}
+}
+
 func (d *LatencyDist) Add(t time.Duration) {
+	d.layout()
 	atomic.AddInt64(&d.N, 1)
+	d.updateMax(t)
+	b := d.ToBucket(t)
+	atomic.AddInt64(&d.Buckets[b], 1)
+}
 
+// AddCorrected adds latency t, correcting for coordinated omission.
+//
+// In a closed-loop benchmark that expects to issue a request every
+// interval, a single slow request delays all of the requests that
+// should have been issued while it was outstanding. The benchmark
+// only observes the one slow request, which understates the tail
+// latency. AddCorrected adds t and also back-fills the latencies the
+// omitted requests would have seen: t-interval, t-2*interval, and so
+// on down to interval. This is equivalent to HdrHistogram's
+// recordValueWithExpectedInterval.
+func (d *LatencyDist) AddCorrected(t, interval time.Duration) {
+	d.Add(t)
+	if interval <= 0 || t < 2*interval {
+		return
+	}
+
+	// The missing samples are t - k*interval for k in [1, k1].
+	// There can be a lot of them, so rather than adding them
+	// one at a time, count how many fall in each bucket.
+	k1 := int64(t/interval) - 1
+	// below returns the number of missing samples < x.
+	below := func(x time.Duration) int64 {
+		if x <= t-time.Duration(k1)*interval {
+			return 0
+		}
+		// Samples < x are those with k > (t-x)/interval.
+		k := int64((t - x) / interval)
+		if k >= k1 {
+			return 0
+		}
+		return k1 - k
+	}
+	minb, maxb := d.ToBucket(t-time.Duration(k1)*interval), d.ToBucket(t-interval)
+	prev := int64(0)
+	for b := minb; b <= maxb; b++ {
+		var n int64
+		if b == maxb {
+			n = k1
+		} else {
+			_, hi := d.FromBucket(b)
+			n = below(hi)
+		}
+		if n > prev {
+			atomic.AddInt64(&d.Buckets[b], n-prev)
+			prev = n
+		}
+	}
+	atomic.AddInt64(&d.N, k1)
+}
+
+func (d *LatencyDist) updateMax(t time.Duration) {
 	max := time.Duration(atomic.LoadInt64((*int64)(&d.Max)))
 	for t > max {
 		if atomic.CompareAndSwapInt64((*int64)(&d.Max), int64(max), int64(t)) {
@@ -36,40 +178,139 @@ func (d *LatencyDist) Add(t time.Duration) {
 		}
 		max = time.Duration(atomic.LoadInt64((*int64)(&d.Max)))
 	}
+}
 
-	b := d.ToBucket(t)
-	atomic.AddInt64(&d.Buckets[b], 1)
+// Snapshot returns a copy of d. It is safe to call Snapshot while
+// other goroutines are adding to d. The snapshot is self-consistent:
+// its N is always the sum of its buckets.
+func (d *LatencyDist) Snapshot() *LatencyDist {
+	s := d.empty()
+	for i := range d.Buckets {
+		count := atomic.LoadInt64(&d.Buckets[i])
+		s.Buckets[i] = count
+		s.N += count
+	}
+	s.Max = time.Duration(atomic.LoadInt64((*int64)(&d.Max)))
+	return s
 }
 
-var latencyBase = math.Log(float64(latencyMax))
+// Merge adds the samples in o to d. It is safe to call Merge while
+// other goroutines are adding to d, but o must not be changing. To
+// merge a distribution that is being added to, merge a snapshot of
+// it.
+//
+// If o has a different bucket layout than d, each of o's buckets is
+// added to d at the bucket's log midpoint.
+func (d *LatencyDist) Merge(o *LatencyDist) {
+	if d.sameLayout(o) {
+		for i, count := range o.Buckets {
+			if count != 0 {
+				atomic.AddInt64(&d.Buckets[i], count)
+			}
+		}
+	} else {
+		for i, count := range o.Buckets {
+			if count != 0 {
+				b := d.ToBucket(o.interpolate(i, 0.5))
+				atomic.AddInt64(&d.Buckets[b], count)
+			}
+		}
+	}
+	atomic.AddInt64(&d.N, o.N)
+	d.updateMax(o.Max)
+}
 
-func (d *LatencyDist) ToBucket(t time.Duration) int {
-	if t < 1 {
-		return 0
+// Sub subtracts the samples in o from d. o must be an earlier
+// snapshot of d, so that d - o is the distribution of samples added
+// between the two. For example, subtracting successive snapshots
+// gives the per-interval distribution of a running LatencyDist.
+//
+// The maximum can't be subtracted, so d.Max is left unchanged and is
+// an upper bound on the maximum of the difference.
+//
+// Sub must not be called concurrently with Add on d.
+func (d *LatencyDist) Sub(o *LatencyDist) {
+	if !d.sameLayout(o) {
+		panic("LatencyDist.Sub: o has a different bucket layout than d")
+	}
+	for i, count := range o.Buckets {
+		if count > d.Buckets[i] {
+			panic("LatencyDist.Sub: o is not a subset of d")
+		}
 	}
-	// Log base latencyMax.
-	b := int(float64(len(d.Buckets)) * math.Log(float64(t)) / latencyBase)
-	if b < 0 {
+	for i, count := range o.Buckets {
+		d.Buckets[i] -= count
+	}
+	d.N -= o.N
+}
+
+// Reset clears all samples from d. Samples added concurrently with
+// Reset may be partially lost; to track a running LatencyDist without
+// losing samples, subtract successive Snapshots instead.
+func (d *LatencyDist) Reset() {
+	d.layout()
+	for i := range d.Buckets {
+		atomic.StoreInt64(&d.Buckets[i], 0)
+	}
+	atomic.StoreInt64(&d.N, 0)
+	atomic.StoreInt64((*int64)(&d.Max), 0)
+}
+
+func (d *LatencyDist) ToBucket(t time.Duration) int {
+	d.layout()
+	if t < d.lo {
 		return 0
 	}
-	if b >= len(d.Buckets) {
+	if t >= d.hi {
 		return len(d.Buckets) - 1
 	}
+	b := 1 + int((math.Log(float64(t))-d.logLo)/d.logRatio)
+	// Guard against rounding error at the edges.
+	if b < 1 {
+		return 1
+	}
+	if b > len(d.Buckets)-2 {
+		return len(d.Buckets) - 2
+	}
 	return b
 }
 
+// FromBucket returns the range of latencies recorded in bucket b.
+// For the overflow bucket, hi is the maximum recorded latency.
 func (d *LatencyDist) FromBucket(b int) (lo, hi time.Duration) {
-	// b = n * log_1s(t) => t = 1s ^ (b / n)
-	if b == 0 {
-		lo = 0
-	} else {
-		lo = time.Duration(math.Pow(float64(latencyMax), float64(b)/float64(len(d.Buckets))))
+	d.layout()
+	switch {
+	case b == 0:
+		return 0, d.lo
+	case b == len(d.Buckets)-1:
+		hi = d.Max
+		if hi < d.hi {
+			hi = d.hi
+		}
+		return d.hi, hi
+	}
+	lo = time.Duration(math.Round(math.Exp(d.logLo + float64(b-1)*d.logRatio)))
+	hi = time.Duration(math.Round(math.Exp(d.logLo + float64(b)*d.logRatio)))
+	if hi > d.hi {
+		hi = d.hi
 	}
-	hi = time.Duration(math.Pow(float64(latencyMax), float64(b+1)/float64(len(d.Buckets))))
 	return
 }
 
+// interpolate returns the latency at fraction frac of the way
+// through bucket b. Samples are assumed to be log-distributed within
+// exponential buckets and uniformly distributed in the underflow
+// bucket.
+func (d *LatencyDist) interpolate(b int, frac float64) time.Duration {
+	lo, hi := d.FromBucket(b)
+	if lo == 0 {
+		return time.Duration(frac * float64(hi))
+	}
+	return time.Duration(math.Exp(math.Log(float64(lo)) + frac*math.Log(float64(hi)/float64(lo))))
+}
+
 func (d *LatencyDist) bounds() (minb, maxb int, any bool) {
+	d.layout()
 	minb, maxb = -1, 1
 	for i, count := range d.Buckets {
 		if count > 0 {
@@ -188,9 +429,12 @@ func (d *LatencyDist) FprintHist(w io.Writer, width, height int) {
 	// Render X ticks. Start with the first power of xBase >= minb.
 	const xBase = 10
 	mint, _ := d.FromBucket(minb)
+	if mint < d.lo {
+		mint = d.lo
+	}
 	tick := time.Duration(math.Pow(xBase, math.Ceil(math.Log(float64(mint))/math.Log(xBase))))
 	tickRow, labelRow := &cells[height], &cells[height+1]
-	for {
+	for tick <= d.hi {
 		col := int(float64(d.ToBucket(tick)-minb) / colWidth)
 		if col >= width {
 			break
@@ -199,6 +443,9 @@ func (d *LatencyDist) FprintHist(w io.Writer, width, height int) {
 		(*tickRow)[col] = '╵'
 		label := []rune(tick.String())
 		start := col - len(label)/2
+		if start < 0 {
+			start = 0
+		}
 		n := copy((*labelRow)[start:], label)
 		if n < len(label) {
 			// Extend the row to fit the label.
@@ -223,7 +470,14 @@ func (d *LatencyDist) FprintHist(w io.Writer, width, height int) {
 	}
 }
 
+// Quantile returns the q'th quantile of d, where q is in [0, 1].
+// Within a bucket, samples are assumed to be log-distributed.
 func (d *LatencyDist) Quantile(q float64) time.Duration {
+	d.layout()
+	if d.N == 0 {
+		return 0
+	}
+
 	// Find the bucket containing this quantile.
 	n := int64(q * float64(d.N+1))
 	if n < 0 {
@@ -236,24 +490,105 @@ func (d *LatencyDist) Quantile(q float64) time.Duration {
 	for ; n >= d.Buckets[b]; n, b = n-d.Buckets[b], b+1 {
 	}
 
-	// Take the midpoint of this bucket.
-	// TODO: Assume samples are log distributed in bucket.
-	lo, hi := d.FromBucket(b)
-	mid := (lo + hi) / 2
-	if mid > d.Max {
+	// Interpolate the n'th of the samples in this bucket.
+	t := d.interpolate(b, (float64(n)+0.5)/float64(d.Buckets[b]))
+	if t > d.Max {
 		return d.Max
 	}
-	return mid
+	return t
+}
+
+// latencyDistJSON is the JSON encoding of a LatencyDist. Since most
+// buckets are typically empty, buckets are stored sparsely as
+// [index, count] pairs.
+type latencyDistJSON struct {
+	N       int64
+	Max     time.Duration
+	Lo, Hi  time.Duration // Range of the exponential buckets
+	RelErr  float64
+	Buckets [][2]int64
+}
+
+// MarshalJSON returns the JSON encoding of d. It is safe to call
+// concurrently with Add.
+func (d *LatencyDist) MarshalJSON() ([]byte, error) {
+	s := d.Snapshot()
+	j := latencyDistJSON{N: s.N, Max: s.Max, Lo: s.lo, Hi: s.hi, RelErr: s.relErr, Buckets: [][2]int64{}}
+	for i, count := range s.Buckets {
+		if count != 0 {
+			j.Buckets = append(j.Buckets, [2]int64{int64(i), count})
+		}
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON sets d to the LatencyDist encoded in data by
+// MarshalJSON. d must be a new LatencyDist.
+func (d *LatencyDist) UnmarshalJSON(data []byte) error {
+	var j latencyDistJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if j.Lo <= 0 || j.Hi <= j.Lo || j.RelErr <= 0 || numBuckets(j.Lo, j.Hi, j.RelErr) > maxLatencyBuckets {
+		return fmt.Errorf("bad latency bucket layout [%s, %s) ±%g", j.Lo, j.Hi, j.RelErr)
+	}
+	d.setLayout(j.Lo, j.Hi, j.RelErr)
+	d.init.Do(func() {})
+	d.N, d.Max = j.N, j.Max
+	for _, b := range j.Buckets {
+		if b[0] < 0 || b[0] >= int64(len(d.Buckets)) {
+			return fmt.Errorf("latency bucket %d out of range", b[0])
+		}
+		if b[1] < 0 {
+			return fmt.Errorf("latency bucket %d has negative count %d", b[0], b[1])
+		}
+		d.Buckets[b[0]] = b[1]
+	}
+	// Quantile relies on N being the total of the buckets.
+	var total int64
+	for _, count := range d.Buckets {
+		if total+count < total {
+			return fmt.Errorf("latency bucket counts overflow")
+		}
+		total += count
+	}
+	if total != d.N {
+		return fmt.Errorf("latency distribution has N=%d, but buckets total %d", d.N, total)
+	}
+	return nil
 }
 
 type LatencyTracker struct {
 	dist *LatencyDist
 	last time.Time
+
+	// corrected, if non-nil, records latencies corrected for
+	// coordinated omission assuming an expected interval of
+	// interval between ticks.
+	corrected *LatencyDist
+	interval  time.Duration
+
+	// series, if non-nil, also records each latency over time.
+	series *LatencySeries
+}
+
+// WithSeries makes t also record each latency in series. It returns
+// t.
+func (t *LatencyTracker) WithSeries(series *LatencySeries) *LatencyTracker {
+	t.series = series
+	return t
 }
 
 func (t *LatencyTracker) Tick() {
 	now := time.Now()
-	t.dist.Add(now.Sub(t.last))
+	lat := now.Sub(t.last)
+	t.dist.Add(lat)
+	if t.corrected != nil {
+		t.corrected.AddCorrected(lat, t.interval)
+	}
+	if t.series != nil {
+		t.series.AddAt(now, lat)
+	}
 	t.last = now
 }
 
@@ -0,0 +1,335 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcbench
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLatencyDistJSON(t *testing.T) {
+	d := NewLatencyDist(time.Microsecond, time.Second, 0.05)
+	for _, lat := range []time.Duration{100 * time.Nanosecond, 5 * time.Microsecond, 5 * time.Microsecond, 3 * time.Millisecond, 2 * time.Second} {
+		d.Add(lat)
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the non-empty buckets are encoded.
+	var j latencyDistJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		t.Fatal(err)
+	}
+	if len(j.Buckets) != 4 {
+		t.Errorf("encoded %d buckets, want the 4 non-empty buckets: %s", len(j.Buckets), data)
+	}
+
+	d2 := new(LatencyDist)
+	if err := json.Unmarshal(data, d2); err != nil {
+		t.Fatal(err)
+	}
+	if d2.N != d.N || d2.Max != d.Max || !reflect.DeepEqual(d2.Buckets, d.Buckets) {
+		t.Errorf("round trip changed distribution: got N=%d Max=%v, want N=%d Max=%v", d2.N, d2.Max, d.N, d.Max)
+	}
+	if !d2.sameLayout(d) {
+		t.Errorf("round trip changed bucket layout")
+	}
+	for _, q := range []float64{0, 0.5, 0.99, 1} {
+		if got, want := d2.Quantile(q), d.Quantile(q); got != want {
+			t.Errorf("Quantile(%v) = %v after round trip, want %v", q, got, want)
+		}
+	}
+
+	for data, want := range map[string]string{
+		`{"N":1,"Lo":0,"Hi":1000,"RelErr":0.01}`:                             "bad latency bucket layout",
+		`{"N":1,"Lo":1000,"Hi":2000,"RelErr":0.01,"Buckets":[[999,1]]}`:      "out of range",
+		`{"N":1,"Lo":1,"Hi":60000000000,"RelErr":1e-9}`:                      "bad latency bucket layout",
+		`{"N":5,"Lo":1000,"Hi":2000,"RelErr":0.01,"Buckets":[[3,2]]}`:        "buckets total 2",
+		`{"N":0,"Lo":1000,"Hi":2000,"RelErr":0.01,"Buckets":[[3,1]]}`:        "buckets total 1",
+		`{"N":0,"Lo":1000,"Hi":2000,"RelErr":0.01,"Buckets":[[3,-1],[4,1]]}`: "negative count",
+	} {
+		err := json.Unmarshal([]byte(data), new(LatencyDist))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Unmarshal(%s): want error containing %q, got %v", data, want, err)
+		}
+	}
+}
+
+func TestLatencyDistSnapshot(t *testing.T) {
+	d := new(LatencyDist)
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				d.Add(time.Duration(g*1000+i%1000) * time.Microsecond)
+			}
+		}(g)
+	}
+	for i := 0; i < 100; i++ {
+		s := d.Snapshot()
+		var sum int64
+		for _, count := range s.Buckets {
+			sum += count
+		}
+		if s.N != sum {
+			t.Fatalf("snapshot N = %d, but its buckets sum to %d", s.N, sum)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	// Once d is quiescent, a snapshot is an exact copy.
+	s := d.Snapshot()
+	if s.N != d.N || s.Max != d.Max || !reflect.DeepEqual(s.Buckets, d.Buckets) {
+		t.Errorf("snapshot of quiescent distribution differs")
+	}
+}
+
+func TestLatencyDistMerge(t *testing.T) {
+	a, b := new(LatencyDist), new(LatencyDist)
+	for i := 1; i <= 100; i++ {
+		a.Add(time.Duration(i) * time.Millisecond)
+		b.Add(time.Duration(i) * time.Microsecond)
+	}
+	b.Merge(a)
+	if b.N != 200 || b.Max != 100*time.Millisecond {
+		t.Errorf("same-layout merge: N=%d Max=%v, want 200, 100ms", b.N, b.Max)
+	}
+
+	// Merging a different layout places each of its buckets at
+	// the bucket's log midpoint, so quantiles are within the
+	// error of the coarser layout.
+	coarse := NewLatencyDist(time.Microsecond, time.Second, 0.1)
+	for i := 1; i <= 100; i++ {
+		coarse.Add(time.Duration(i) * time.Millisecond)
+	}
+	fine := new(LatencyDist)
+	fine.Merge(coarse)
+	if fine.N != 100 || fine.Max != 100*time.Millisecond {
+		t.Errorf("cross-layout merge: N=%d Max=%v, want 100, 100ms", fine.N, fine.Max)
+	}
+	var sum int64
+	for _, count := range fine.Buckets {
+		sum += count
+	}
+	if sum != 100 {
+		t.Errorf("cross-layout merge: buckets sum to %d, want 100", sum)
+	}
+	if got, want := fine.Quantile(0.5), 50*time.Millisecond; !within(got, want, 0.1) {
+		t.Errorf("cross-layout merge: median %v, want %v ±10%%", got, want)
+	}
+}
+
+func TestLatencyDistSub(t *testing.T) {
+	d := new(LatencyDist)
+	for i := 1; i <= 10; i++ {
+		d.Add(time.Duration(i) * time.Millisecond)
+	}
+	before := d.Snapshot()
+	for i := 1; i <= 5; i++ {
+		d.Add(time.Second)
+	}
+	d.Sub(before)
+	if d.N != 5 || d.Quantile(0) < 990*time.Millisecond {
+		t.Errorf("after Sub: N=%d min=%v, want 5 samples of 1s", d.N, d.Quantile(0))
+	}
+
+	// o must be a subset of d.
+	other := new(LatencyDist)
+	other.Add(time.Microsecond)
+	func() {
+		defer func() {
+			if err := recover(); err == nil || !strings.Contains(err.(string), "not a subset") {
+				t.Errorf("Sub of non-subset: want panic about subset, got %v", err)
+			}
+		}()
+		d.Sub(other)
+	}()
+	if d.N != 5 {
+		t.Errorf("failed Sub changed N to %d", d.N)
+	}
+}
+
+func TestLatencyDistReset(t *testing.T) {
+	d := NewLatencyDist(time.Microsecond, time.Second, 0.05)
+	d.Add(time.Millisecond)
+	d.Add(time.Minute)
+	d.Reset()
+	if d.N != 0 || d.Max != 0 || d.Quantile(0.5) != 0 {
+		t.Errorf("after Reset: N=%d Max=%v", d.N, d.Max)
+	}
+	for _, count := range d.Buckets {
+		if count != 0 {
+			t.Fatalf("after Reset: non-empty bucket")
+		}
+	}
+	// Reset keeps the layout.
+	if d.lo != time.Microsecond || d.hi != time.Second || d.relErr != 0.05 {
+		t.Errorf("Reset changed layout")
+	}
+	d.Add(time.Millisecond)
+	if d.N != 1 || d.Max != time.Millisecond {
+		t.Errorf("after Reset and Add: N=%d Max=%v", d.N, d.Max)
+	}
+}
+
+// within returns whether got is within relative error relErr of want.
+func within(got, want time.Duration, relErr float64) bool {
+	diff := float64(got - want)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= relErr*float64(want)
+}
+
+func TestLatencyDistBuckets(t *testing.T) {
+	for _, d := range []*LatencyDist{new(LatencyDist), NewLatencyDist(time.Microsecond, time.Second, 0.05)} {
+		d.layout()
+		// Every exponential bucket spans at most a factor of
+		// 1+relErr, and each latency falls in its bucket.
+		for b := 1; b < len(d.Buckets)-1; b++ {
+			lo, hi := d.FromBucket(b)
+			if float64(hi) > float64(lo)*(1+d.relErr)*(1+1e-9)+1 {
+				t.Fatalf("bucket %d [%v, %v) is wider than ±%g", b, lo, hi, d.relErr)
+			}
+		}
+		for lat := d.lo; lat < d.hi; lat = lat*101/100 + 1 {
+			b := d.ToBucket(lat)
+			if lo, hi := d.FromBucket(b); lat < lo-1 || lat > hi+1 {
+				t.Fatalf("%v is in bucket %d [%v, %v)", lat, b, lo, hi)
+			}
+		}
+
+		// Latencies outside [lo, hi) go in the underflow and
+		// overflow buckets.
+		if b := d.ToBucket(d.lo - 1); b != 0 {
+			t.Errorf("%v is in bucket %d, want underflow bucket", d.lo-1, b)
+		}
+		if b := d.ToBucket(d.hi); b != len(d.Buckets)-1 {
+			t.Errorf("%v is in bucket %d, want overflow bucket", d.hi, b)
+		}
+		d.Add(2 * d.hi)
+		if lo, hi := d.FromBucket(len(d.Buckets) - 1); lo != d.hi || hi != 2*d.hi {
+			t.Errorf("overflow bucket is [%v, %v), want [%v, %v)", lo, hi, d.hi, 2*d.hi)
+		}
+	}
+
+	for _, layout := range [][3]float64{{0, 1e9, 0.01}, {1e3, 1e3, 0.01}, {1e3, 1e9, 0}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewLatencyDist%v: want panic", layout)
+				}
+			}()
+			NewLatencyDist(time.Duration(layout[0]), time.Duration(layout[1]), layout[2])
+		}()
+	}
+}
+
+func TestLatencyDistQuantile(t *testing.T) {
+	for _, relErr := range []float64{0.01, 0.1} {
+		d := NewLatencyDist(time.Microsecond, time.Second, relErr)
+		// Log-uniform samples from 1µs to 1s.
+		var samples []time.Duration
+		for lat := float64(time.Microsecond); lat < float64(time.Second); lat *= 1.003 {
+			samples = append(samples, time.Duration(lat))
+			d.Add(time.Duration(lat))
+		}
+		for _, q := range []float64{0, 0.01, 0.25, 0.5, 0.9, 0.99, 0.999, 1} {
+			n := int(q * float64(len(samples)+1))
+			if n > len(samples)-1 {
+				n = len(samples) - 1
+			}
+			if got, want := d.Quantile(q), samples[n]; !within(got, want, relErr) {
+				t.Errorf("relErr %g: Quantile(%v) = %v, want %v ±%g", relErr, q, got, want, relErr)
+			}
+		}
+	}
+
+	// Within a bucket, samples are log-distributed, so the median
+	// of a bucket is its geometric midpoint.
+	d := NewLatencyDist(time.Microsecond, time.Second, 0.5)
+	lo, hi := d.FromBucket(5)
+	if got, want := d.interpolate(5, 0.5), time.Duration(math.Sqrt(float64(lo)*float64(hi))); got < want-1 || got > want+1 {
+		t.Errorf("interpolate(5, 0.5) = %v, want geometric midpoint %v of [%v, %v)", got, want, lo, hi)
+	}
+	// The underflow bucket is uniform.
+	if got := d.interpolate(0, 0.5); got != 500*time.Nanosecond {
+		t.Errorf("interpolate(0, 0.5) = %v, want 500ns", got)
+	}
+
+	// Quantiles in the overflow bucket are interpolated up to the
+	// maximum.
+	d.Add(time.Hour)
+	if got := d.Quantile(1); got < time.Second || got > time.Hour {
+		t.Errorf("Quantile(1) = %v, want in overflow bucket [1s, 1h]", got)
+	}
+	if got := new(LatencyDist).Quantile(0.5); got != 0 {
+		t.Errorf("Quantile of empty distribution = %v, want 0", got)
+	}
+}
+
+func TestLatencyDistAddCorrected(t *testing.T) {
+	ms := time.Millisecond
+	for _, layout := range []*LatencyDist{new(LatencyDist), NewLatencyDist(time.Microsecond, time.Second, 0.5)} {
+		d := layout.empty()
+		d.AddCorrected(10*ms, ms)
+		// The back-filled samples are 9ms, 8ms, ..., 1ms.
+		want := layout.empty()
+		for lat := ms; lat <= 10*ms; lat += ms {
+			want.Add(lat)
+		}
+		if d.N != 10 || d.Max != 10*ms {
+			t.Errorf("AddCorrected(10ms, 1ms): N=%d Max=%v, want 10, 10ms", d.N, d.Max)
+		}
+		if !reflect.DeepEqual(d.Buckets, want.Buckets) {
+			t.Errorf("AddCorrected(10ms, 1ms) with relErr %g: buckets differ from adding 1ms..10ms", layout.relErr)
+		}
+
+		// Many back-filled samples, not a multiple of the
+		// interval.
+		d, want = layout.empty(), layout.empty()
+		d.AddCorrected(1234567*time.Microsecond, 997*time.Microsecond)
+		for lat := 1234567 * time.Microsecond; lat >= 997*time.Microsecond; lat -= 997 * time.Microsecond {
+			want.Add(lat)
+		}
+		if d.N != want.N || !reflect.DeepEqual(d.Buckets, want.Buckets) {
+			t.Errorf("AddCorrected(1.234567s, 997µs): N=%d, want %d; buckets equal %v", d.N, want.N, reflect.DeepEqual(d.Buckets, want.Buckets))
+		}
+	}
+
+	// Latencies below twice the interval, and non-positive
+	// intervals, add exactly one sample.
+	for _, test := range []struct{ lat, interval time.Duration }{
+		{ms, ms},
+		{2*ms - 1, ms},
+		{10 * ms, 0},
+	} {
+		d := new(LatencyDist)
+		d.AddCorrected(test.lat, test.interval)
+		var sum int64
+		for _, count := range d.Buckets {
+			sum += count
+		}
+		if d.N != 1 || sum != 1 {
+			t.Errorf("AddCorrected(%v, %v): N=%d, buckets sum to %d, want 1", test.lat, test.interval, d.N, sum)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcbench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencySeries records latencies over time as a ring of
+// per-interval LatencyDists. Unlike a single LatencyDist, this shows
+// how latency changes over the course of a run, for example, whether
+// tail latency spikes line up with GC cycles.
+//
+// Intervals are aligned to when the process started, which is also
+// the time base of the gctrace. Once the ring is full, the oldest
+// intervals are discarded.
+type LatencySeries struct {
+	// Interval is the duration of each interval.
+	Interval time.Duration
+
+	lock  sync.Mutex
+	slots []seriesSlot
+}
+
+type seriesSlot struct {
+	index int64 // Interval number since process start, or -1
+	dist  *LatencyDist
+}
+
+// seriesRelErr is the relative error of the per-interval
+// distributions. This is coarser than the LatencyDist default to
+// keep the memory footprint of a long series down.
+const seriesRelErr = 0.05
+
+// NewLatencySeries returns a LatencySeries that records the most
+// recent n intervals of the given duration.
+func NewLatencySeries(interval time.Duration, n int) *LatencySeries {
+	if interval <= 0 || n <= 0 {
+		panic("bad LatencySeries interval or length")
+	}
+	s := &LatencySeries{Interval: interval, slots: make([]seriesSlot, n)}
+	for i := range s.slots {
+		s.slots[i].index = -1
+	}
+	return s
+}
+
+// Add records latency t for an operation that finished now.
+func (s *LatencySeries) Add(t time.Duration) {
+	s.AddAt(time.Now(), t)
+}
+
+// AddAt records latency t for an operation that finished at end.
+func (s *LatencySeries) AddAt(end time.Time, t time.Duration) {
+	s.dist(int64(end.Sub(processStart) / s.Interval)).Add(t)
+}
+
+// dist returns the distribution for interval index, starting a new
+// interval if necessary.
+func (s *LatencySeries) dist(index int64) *LatencyDist {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	slot := &s.slots[index%int64(len(s.slots))]
+	if slot.index != index {
+		if slot.index > index {
+			// This sample is older than the ring. Record
+			// it in a distribution that will be dropped.
+			return NewLatencyDist(defaultLatencyMin, defaultLatencyMax, seriesRelErr)
+		}
+		slot.index = index
+		slot.dist = NewLatencyDist(defaultLatencyMin, defaultLatencyMax, seriesRelErr)
+	}
+	return slot.dist
+}
+
+// LatencyInterval is the latency distribution of one interval of a
+// LatencySeries.
+type LatencyInterval struct {
+	// Start is the start of this interval, relative to when the
+	// process started.
+	Start time.Duration
+
+	// Dist is the distribution of latencies that ended in this
+	// interval.
+	Dist *LatencyDist
+
+	// GCs is the set of GC cycles that overlap this interval.
+	GCs []GCCycle `json:"-"`
+}
+
+// Intervals returns snapshots of the non-empty intervals in s, in
+// time order. If trace is non-nil, it also sets the GCs of each
+// interval to the GC cycles in trace that overlap it.
+func (s *LatencySeries) Intervals(trace GCTrace) []LatencyInterval {
+	s.lock.Lock()
+	var out []LatencyInterval
+	for _, slot := range s.slots {
+		if slot.index < 0 {
+			continue
+		}
+		d := slot.dist.Snapshot()
+		if d.N == 0 {
+			continue
+		}
+		out = append(out, LatencyInterval{Start: time.Duration(slot.index) * s.Interval, Dist: d})
+	}
+	s.lock.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+
+	for i := range out {
+		iv := &out[i]
+		end := iv.Start + s.Interval
+		for _, c := range trace {
+			if c.Start < end && c.End > iv.Start {
+				iv.GCs = append(iv.GCs, c)
+			}
+		}
+	}
+	return out
+}
+
+// SplitGC merges the intervals of s into a distribution of the
+// latencies in intervals that overlap a GC cycle in trace and a
+// distribution of those in intervals that don't. Forced GC cycles
+// are ignored.
+func (s *LatencySeries) SplitGC(trace GCTrace) (inGC, outGC *LatencyDist) {
+	inGC = NewLatencyDist(defaultLatencyMin, defaultLatencyMax, seriesRelErr)
+	outGC = NewLatencyDist(defaultLatencyMin, defaultLatencyMax, seriesRelErr)
+	for _, iv := range s.Intervals(trace.WithoutForced()) {
+		if len(iv.GCs) > 0 {
+			inGC.Merge(iv.Dist)
+		} else {
+			outGC.Merge(iv.Dist)
+		}
+	}
+	return
+}
+
+// FprintGCReport prints a table of the 99th percentile and maximum
+// latency of each interval of s along with the GC cycles in trace
+// that overlap it.
+func (s *LatencySeries) FprintGCReport(w io.Writer, trace GCTrace) {
+	fmt.Fprintf(w, "%12s %8s %12s %12s  %s\n", "start", "N", "P99", "max", "GCs")
+	for _, iv := range s.Intervals(trace) {
+		gcs := ""
+		for i, c := range iv.GCs {
+			if i > 0 {
+				gcs += " "
+			}
+			gcs += fmt.Sprint(c.N)
+			if c.Forced {
+				gcs += "(forced)"
+			}
+		}
+		fmt.Fprintf(w, "%12s %8d %12s %12s  %s\n", iv.Start, iv.Dist.N, iv.Dist.Quantile(0.99), iv.Dist.Max, gcs)
+	}
+}
+
+// latencySeriesJSON is the JSON encoding of a LatencySeries.
+type latencySeriesJSON struct {
+	Interval  time.Duration
+	Intervals []LatencyInterval
+}
+
+// MarshalJSON returns the JSON encoding of s. It is safe to call
+// concurrently with Add.
+func (s *LatencySeries) MarshalJSON() ([]byte, error) {
+	ivs := s.Intervals(nil)
+	if ivs == nil {
+		ivs = []LatencyInterval{}
+	}
+	return json.Marshal(latencySeriesJSON{s.Interval, ivs})
+}
+
+// maxSeriesSlots bounds the ring of a decoded LatencySeries, so a
+// corrupt encoding can't force a huge allocation.
+const maxSeriesSlots = 1 << 20
+
+// UnmarshalJSON sets s to the LatencySeries encoded in data by
+// MarshalJSON. The ring will be just large enough to span the
+// encoded intervals.
+func (s *LatencySeries) UnmarshalJSON(data []byte) error {
+	var j latencySeriesJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if j.Interval <= 0 {
+		return fmt.Errorf("bad latency series interval %s", j.Interval)
+	}
+	s.Interval = j.Interval
+	if len(j.Intervals) == 0 {
+		s.slots = []seriesSlot{{index: -1}}
+		return nil
+	}
+	for i, iv := range j.Intervals {
+		if iv.Start < 0 || iv.Start%j.Interval != 0 {
+			return fmt.Errorf("latency series interval start %s is not a multiple of %s", iv.Start, j.Interval)
+		}
+		if i > 0 && iv.Start <= j.Intervals[i-1].Start {
+			return fmt.Errorf("latency series intervals out of order at %s", iv.Start)
+		}
+		if iv.Dist == nil {
+			return fmt.Errorf("latency series interval at %s has no distribution", iv.Start)
+		}
+	}
+	first := int64(j.Intervals[0].Start / j.Interval)
+	last := int64(j.Intervals[len(j.Intervals)-1].Start / j.Interval)
+	if last-first >= maxSeriesSlots {
+		return fmt.Errorf("latency series spans %d intervals, more than %d", last-first+1, maxSeriesSlots)
+	}
+	s.slots = make([]seriesSlot, last-first+1)
+	for i := range s.slots {
+		s.slots[i].index = -1
+	}
+	for _, iv := range j.Intervals {
+		index := int64(iv.Start / j.Interval)
+		s.slots[index%int64(len(s.slots))] = seriesSlot{index, iv.Dist}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcbench
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const ms = time.Millisecond
+
+// addInterval adds n samples of latency lat to interval i of s.
+func addInterval(s *LatencySeries, i int, n int, lat time.Duration) {
+	for j := 0; j < n; j++ {
+		s.AddAt(processStart.Add(time.Duration(i)*s.Interval+s.Interval/2), lat)
+	}
+}
+
+// starts returns the start times and sample counts of the intervals
+// of s.
+func starts(ivs []LatencyInterval) (starts []time.Duration, ns []int64) {
+	for _, iv := range ivs {
+		starts = append(starts, iv.Start)
+		ns = append(ns, iv.Dist.N)
+	}
+	return
+}
+
+func TestLatencySeriesWraparound(t *testing.T) {
+	s := NewLatencySeries(10*ms, 3)
+	for i := 0; i < 5; i++ {
+		addInterval(s, i, i+1, ms)
+	}
+	// The ring holds the 3 most recent intervals.
+	gotStarts, gotNs := starts(s.Intervals(nil))
+	if want := []time.Duration{20 * ms, 30 * ms, 40 * ms}; !reflect.DeepEqual(gotStarts, want) {
+		t.Errorf("intervals start at %v, want %v", gotStarts, want)
+	}
+	if want := []int64{3, 4, 5}; !reflect.DeepEqual(gotNs, want) {
+		t.Errorf("intervals have %v samples, want %v", gotNs, want)
+	}
+
+	// Samples older than the ring are dropped rather than
+	// overwriting a newer interval.
+	addInterval(s, 1, 1, ms)
+	if _, gotNs := starts(s.Intervals(nil)); !reflect.DeepEqual(gotNs, []int64{3, 4, 5}) {
+		t.Errorf("after adding an old sample, intervals have %v samples, want [3 4 5]", gotNs)
+	}
+
+	// Empty intervals are omitted.
+	s = NewLatencySeries(10*ms, 4)
+	addInterval(s, 0, 1, ms)
+	addInterval(s, 2, 1, ms)
+	if gotStarts, _ := starts(s.Intervals(nil)); !reflect.DeepEqual(gotStarts, []time.Duration{0, 20 * ms}) {
+		t.Errorf("intervals start at %v, want [0 20ms]", gotStarts)
+	}
+}
+
+func TestLatencySeriesSplitGC(t *testing.T) {
+	s := NewLatencySeries(10*ms, 10)
+	for i := 0; i < 5; i++ {
+		addInterval(s, i, 1, time.Duration(i+1)*ms)
+	}
+	trace := GCTrace{
+		// Overlaps intervals 1 and 2.
+		{N: 1, Start: 15 * ms, End: 25 * ms},
+		// Forced GCs are ignored by SplitGC.
+		{N: 2, Start: 41 * ms, End: 42 * ms, Forced: true},
+	}
+
+	ivs := s.Intervals(trace)
+	var gcs [][]int
+	for _, iv := range ivs {
+		var ns []int
+		for _, c := range iv.GCs {
+			ns = append(ns, c.N)
+		}
+		gcs = append(gcs, ns)
+	}
+	if want := [][]int{nil, {1}, {1}, nil, {2}}; !reflect.DeepEqual(gcs, want) {
+		t.Errorf("interval GCs are %v, want %v", gcs, want)
+	}
+
+	inGC, outGC := s.SplitGC(trace)
+	if inGC.N != 2 || outGC.N != 3 {
+		t.Fatalf("SplitGC: %d samples in GC and %d out, want 2 and 3", inGC.N, outGC.N)
+	}
+	if inGC.Max != 3*ms || outGC.Max != 5*ms {
+		t.Errorf("SplitGC: max in GC %v, out %v; want 3ms, 5ms", inGC.Max, outGC.Max)
+	}
+}
+
+func TestLatencySeriesJSON(t *testing.T) {
+	s := NewLatencySeries(10*ms, 100)
+	addInterval(s, 7, 2, ms)
+	addInterval(s, 9, 3, 2*ms)
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2 := new(LatencySeries)
+	if err := json.Unmarshal(data, s2); err != nil {
+		t.Fatal(err)
+	}
+	if s2.Interval != s.Interval {
+		t.Errorf("interval %v after round trip, want %v", s2.Interval, s.Interval)
+	}
+	gotStarts, gotNs := starts(s2.Intervals(nil))
+	wantStarts, wantNs := starts(s.Intervals(nil))
+	if !reflect.DeepEqual(gotStarts, wantStarts) || !reflect.DeepEqual(gotNs, wantNs) {
+		t.Errorf("round trip gave intervals %v with %v samples, want %v with %v", gotStarts, gotNs, wantStarts, wantNs)
+	}
+	// The ring spans just the encoded intervals.
+	if len(s2.slots) != 3 {
+		t.Errorf("round trip ring has %d slots, want 3", len(s2.slots))
+	}
+
+	// An empty series round-trips.
+	data, err = json.Marshal(NewLatencySeries(ms, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, s2); err != nil || len(s2.Intervals(nil)) != 0 {
+		t.Errorf("empty series round trip: %v intervals, error %v", len(s2.Intervals(nil)), err)
+	}
+
+	// iv returns an encoded empty interval starting at start.
+	iv := func(start string) string {
+		return `{"Start":` + start + `,"Dist":{"N":0,"Lo":100,"Hi":60000000000,"RelErr":0.05}}`
+	}
+	for _, test := range []struct {
+		data, want string
+	}{
+		{`{"Interval":0}`, "bad latency series interval"},
+		{`{"Interval":10,"Intervals":[` + iv("20") + "," + iv("10") + `]}`, "out of order"},
+		{`{"Interval":10,"Intervals":[` + iv("10") + "," + iv("10") + `]}`, "out of order"},
+		{`{"Interval":10,"Intervals":[` + iv("15") + `]}`, "not a multiple"},
+		{`{"Interval":10,"Intervals":[` + iv("-10") + `]}`, "not a multiple"},
+		{`{"Interval":10,"Intervals":[{"Start":10,"Dist":null}]}`, "no distribution"},
+		{`{"Interval":10,"Intervals":[{"Start":10}]}`, "no distribution"},
+		{`{"Interval":1,"Intervals":[` + iv("0") + "," + iv("1000000000000") + `]}`, "more than"},
+	} {
+		err := json.Unmarshal([]byte(test.data), new(LatencySeries))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Unmarshal(%s): want error containing %q, got %v", test.data, test.want, err)
+		}
+	}
+}
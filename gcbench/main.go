@@ -8,6 +8,8 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
 	"os"
 	"os/exec"
@@ -17,6 +19,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
 // TODO: Having the benchmarks all os.Exit to finish is a pain for
@@ -39,8 +42,17 @@ func NewBenchmark(name string, main func()) *Benchmark {
 	return &Benchmark{name, nil, main}
 }
 
+// Config adds a name:value configuration setting to the benchmark's
+// full name. Since "/" separates settings in the full name, Config
+// replaces "/" and white space in value with "_".
 func (b *Benchmark) Config(name string, value interface{}) *Benchmark {
-	b.cfg = append(b.cfg, config{name, fmt.Sprint(value)})
+	v := strings.Map(func(r rune) rune {
+		if r == '/' || unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, fmt.Sprint(value))
+	b.cfg = append(b.cfg, config{name, v})
 	return b
 }
 
@@ -79,10 +91,12 @@ func (b *Benchmark) Run() {
 				}
 				b.main()
 			}()
+			reportChurners()
 		}
 		os.Exit(0)
 	}
 
+	printEnvOnce.Do(printEnv)
 	fmt.Printf("%s\t", b.FullName())
 
 	godebug := os.Getenv("GODEBUG")
@@ -91,37 +105,91 @@ func (b *Benchmark) Run() {
 	}
 	godebug += "gctrace=1"
 
+	// Create the report channel.
+	rr, rw, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create report pipe: %s\n", err)
+		return
+	}
+	defer rr.Close()
+
 	cmd := exec.Command(os.Args[0], os.Args[1:]...)
-	cmd.Env = append([]string{"GODEBUG=" + godebug, "GCBENCH=" + b.FullName()}, os.Environ()...)
+	// Later entries take precedence, so these override anything
+	// inherited from our environment.
+	cmd.Env = append(os.Environ(), "GODEBUG="+godebug, "GCBENCH="+b.FullName(), reportFDEnv+"=3")
+	cmd.ExtraFiles = []*os.File{rw}
+	var outBuf bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &outBuf, &outBuf
 	startTime := time.Now()
-	out, err := cmd.CombinedOutput()
+	err = cmd.Start()
+	// Close our copy of the write side so we see EOF when the
+	// benchmark (and any subprocesses) exit.
+	rw.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to run %s: %s\n", os.Args[0], err)
+		return
+	}
+	type reports struct {
+		msgs []message
+		err  error
+	}
+	msgsc := make(chan reports, 1)
+	go func() {
+		msgs, err := readMessages(rr)
+		if err != nil {
+			// Keep draining the pipe so the benchmark
+			// doesn't block writing to it.
+			io.Copy(ioutil.Discard, rr)
+		}
+		msgsc <- reports{msgs, err}
+	}()
+	err = cmd.Wait()
+	out := outBuf.Bytes()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to run %s: %s\n%s\n", os.Args[0], err, indent(string(out)))
 		return
 	}
 	endTime := time.Now()
+	r := <-msgsc
+	if r.err != nil {
+		// Some reports may be missing, so the results
+		// would be incomplete.
+		fmt.Fprintf(os.Stderr, "failed to read reports from %s: %s\n%s\n", os.Args[0], r.err, indent(string(out)))
+		return
+	}
+	msgs := r.msgs
 
-	// Parse extra metrics.
+	// Process reports.
 	extra := map[string]float64{}
-	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
-		if !strings.HasPrefix(line, "metric ") {
-			continue
+	latency := map[string]*LatencyDist{}
+	series := map[string]*LatencySeries{}
+	var phases []Phase
+	failed := false
+	for _, m := range msgs {
+		switch m.Kind {
+		case "metric":
+			extra[m.Name] = m.Value
+		case "phase":
+			phases = append(phases, Phase{m.Name, m.Time})
+		case "latency":
+			// Several processes may report shards of the
+			// same distribution. Pool them.
+			if d := latency[m.Name]; d != nil {
+				d.Merge(m.Latency)
+			} else {
+				latency[m.Name] = m.Latency
+			}
+		case "latency-series":
+			series[m.Name] = m.Series
+		case "error":
+			fmt.Fprintf(os.Stderr, "%s reported error: %s\n", os.Args[0], m.Error)
+			failed = true
 		}
-		fs := strings.Fields(line)
-		if len(fs) != 3 {
-			continue
-		}
-		v, err := strconv.ParseFloat(fs[1], 64)
-		if err != nil {
-			continue
-		}
-		extra[fs[2]] = v
 	}
-	extraKeys := []string{}
-	for k := range extra {
-		extraKeys = append(extraKeys, k)
+	if failed {
+		fmt.Fprintf(os.Stderr, "%s\n", indent(string(out)))
+		return
 	}
-	sort.Strings(extraKeys)
 
 	// Parse the GC trace.
 	gctrace, err := ParseGCTrace(string(out))
@@ -130,7 +198,25 @@ func (b *Benchmark) Run() {
 		return
 	}
 
-	run := RunInfo{Trace: gctrace, StartTime: startTime, EndTime: endTime}
+	for name, dist := range latency {
+		if err := latencyMetrics(extra, name, dist); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+	}
+	for name, s := range series {
+		if err := seriesMetrics(extra, name, s, gctrace); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+	}
+	run := RunInfo{Trace: gctrace, Phases: phases, StartTime: startTime, EndTime: endTime}
+	addPhaseMetrics(extra, run)
+	extraKeys := []string{}
+	for k := range extra {
+		extraKeys = append(extraKeys, k)
+	}
+	sort.Strings(extraKeys)
 
 	// Print metrics.
 	fmt.Printf("%d", 1)
@@ -141,6 +227,13 @@ func (b *Benchmark) Run() {
 	if os.Getenv("TERM") != "dumb" {
 		align = strings.Repeat("\t", 15) + " "
 	}
+	result := &RunResult{Name: b.FullName(), Result: map[string]float64{}, Trace: gctrace, Phases: phases}
+	if len(latency) > 0 {
+		result.Latency = latency
+	}
+	if len(series) > 0 {
+		result.LatencySeries = series
+	}
 	vals := make([]float64, len(metrics))
 	for i, metric := range metrics {
 		vals[i] = metric.Fn(run)
@@ -148,12 +241,18 @@ func (b *Benchmark) Run() {
 			continue
 		}
 		fmt.Printf("%s%10s %s", align, sigfigs(vals[i]), metric.Label)
+		result.Result[metric.Label] = vals[i]
 	}
 	for _, k := range extraKeys {
 		fmt.Printf("%s%10s %s", align, sigfigs(extra[k]), k)
+		result.Result[k] = extra[k]
 	}
 	fmt.Printf("\n")
 
+	if err := result.writeJSON(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write JSON results: %s\n", err)
+	}
+
 	// Print warnings.
 	for i, metric := range metrics {
 		if metric.Check != nil && !math.IsNaN(vals[i]) {
@@ -161,10 +260,23 @@ func (b *Benchmark) Run() {
 		}
 	}
 
+	// Print latency series reports.
+	if *flagLatencyReport {
+		seriesNames := []string{}
+		for name := range series {
+			seriesNames = append(seriesNames, name)
+		}
+		sort.Strings(seriesNames)
+		for _, name := range seriesNames {
+			fmt.Fprintf(os.Stderr, "%s by interval:\n", name)
+			series[name].FprintGCReport(os.Stderr, gctrace)
+		}
+	}
+
 	// Print any non-GC output.
 	nongc := []string{}
 	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
-		if *flagGCTrace || !strings.HasPrefix(line, "gc ") && !strings.HasPrefix(line, "metric ") {
+		if *flagGCTrace || !gcTraceLine.MatchString(line) {
 			nongc = append(nongc, line)
 		}
 	}
@@ -188,10 +300,3 @@ func sigfigs(v float64) string {
 		prec++
 	}
 }
-
-// ReportExtra can be used by a benchmark main function to report
-// extra metrics.
-func ReportExtra(metric string, val float64) {
-	fmt.Fprintf(os.Stderr, "metric %v %s\n", val, metric)
-}
-
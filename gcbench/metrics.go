@@ -10,12 +10,17 @@ import (
 	"os"
 	"reflect"
 	"sort"
+	"strings"
 	"time"
 )
 
 type RunInfo struct {
 	Trace GCTrace
 
+	// Phases is the sequence of phases reported by the benchmark
+	// with ReportPhase.
+	Phases []Phase
+
 	StartTime, EndTime time.Time
 }
 
@@ -36,6 +41,52 @@ var metrics = []Metric{
 	{"95%ile-CPU-util", distMetric(cpuUtil, 0.95), warnIf(">", .5)},
 }
 
+// phaseMetrics are computed separately for each phase reported by the
+// benchmark, over the GC cycles that started during that phase. If a
+// benchmark reports the same phase name several times, the metric is
+// computed over all of them.
+var phaseMetrics = []Metric{
+	{"95%ile-heap-overshoot", distMetric(heapOvershoot, 0.95), nil},
+	{"95%ile-CPU-util", distMetric(cpuUtil, 0.95), nil},
+	{"assist-util", assistUtil, nil},
+}
+
+// phaseRuns splits run into a RunInfo for each distinct phase name.
+// The trace of each contains the GC cycles that started during a
+// phase with that name.
+func phaseRuns(run RunInfo) map[string]RunInfo {
+	runs := make(map[string]RunInfo)
+	for i, ph := range run.Phases {
+		end := time.Duration(math.MaxInt64)
+		if i+1 < len(run.Phases) {
+			end = run.Phases[i+1].Start
+		}
+		pr := runs[ph.Name]
+		pr.Phases = append(pr.Phases, ph)
+		pr.StartTime, pr.EndTime = run.StartTime, run.EndTime
+		for _, c := range run.Trace {
+			if ph.Start <= c.Start && c.Start < end {
+				pr.Trace = append(pr.Trace, c)
+			}
+		}
+		runs[ph.Name] = pr
+	}
+	return runs
+}
+
+// addPhaseMetrics adds phaseMetrics for each phase of run to extra,
+// named by appending the phase name to the metric label.
+func addPhaseMetrics(extra map[string]float64, run RunInfo) {
+	for name, pr := range phaseRuns(run) {
+		name = strings.Join(strings.Fields(name), "_")
+		for _, metric := range phaseMetrics {
+			if v := metric.Fn(pr); !math.IsNaN(v) {
+				extra[metric.Label+"-"+name] = v
+			}
+		}
+	}
+}
+
 func gcsPerOp(run RunInfo) float64 {
 	t := run.Trace.WithoutForced()
 	return float64(len(t))
@@ -105,6 +156,21 @@ func cpuUtil(run RunInfo) distribution {
 	return util
 }
 
+// assistUtil returns the fraction of CPU time during the mark phase
+// spent in mutator assists, over all cycles.
+func assistUtil(run RunInfo) float64 {
+	t := run.Trace.WithoutForced()
+	var assist, avail float64
+	for _, c := range t {
+		assist += float64(c.CPUAssist)
+		avail += float64(c.ClockMark) * float64(c.Procs)
+	}
+	if avail == 0 {
+		return math.NaN()
+	}
+	return assist / avail
+}
+
 type distribution []float64
 
 // distMetric transforms a distribution metric into a point metric at
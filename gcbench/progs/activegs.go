@@ -41,10 +41,13 @@ func live(ch chan struct{}) {
 var (
 	flagDuration = flag.Duration("benchtime", 10*time.Second, "steady state duration")
 	// 5e5 Gs uses about 2.5GB of memory.
-	flagGs        = flag.Int("active-gs", 5e5, "start `n` active goroutines")
-	flagStackSize = gcbench.FlagBytes("stack-size", 1*gcbench.KB, "stack size")
+	flagGs           = flag.Int("active-gs", 5e5, "start `n` active goroutines")
+	flagStackSize    = gcbench.FlagBytes("stack-size", 1*gcbench.KB, "stack size")
+	flagBallastShape = flag.String("ballast-shape", "AST", "heap `shape` of the ballast, optionally with parameters; one of\n"+heapgen.ShapeHelp())
 )
 
+var ballastGen func() interface{}
+
 func main() {
 	memstats := new(runtime.MemStats)
 	start := time.Now()
@@ -54,14 +57,31 @@ func main() {
 		os.Exit(2)
 	}
 
-	gcbench.NewBenchmark("ActiveGs", benchMain).Config("active-gs", *flagGs).Config("stack-size", *flagStackSize).Run()
+	ballastShape, err := heapgen.Shape(*flagBallastShape)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	ballastGen = ballastShape
+
+	b := gcbench.NewBenchmark("ActiveGs", benchMain).Config("active-gs", *flagGs).Config("stack-size", *flagStackSize)
+	if *flagBallastShape != "AST" {
+		b.Config("ballast-shape", *flagBallastShape)
+	}
+	b.Run()
 	elapsed := time.Since(start)
 	fmt.Print("time: ", elapsed)
 	printMemStats(memstats)
 }
 
 func benchMain() {
-	m := heapgen.Measure(heapgen.MakeAST)
+	m, err := heapgen.Measure(ballastGen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "measuring ballast: %v\n", err)
+		gcbench.ReportError(err)
+		os.Exit(1)
+	}
 	ballast = heapgen.Generate(m.Gen, m.BytesRetained, ballastSize)
 
 	var chs []chan struct{}
@@ -76,11 +96,14 @@ func benchMain() {
 		BytesPerSec: garbagePerSec,
 	}).Start()
 
-	time.AfterFunc(*flagDuration, func() {
-		os.Exit(0)
-	})
-
-	for _ = range time.Tick(stackPeriod) {
+	done := time.After(*flagDuration)
+	tick := time.Tick(stackPeriod)
+	for {
+		select {
+		case <-done:
+			return
+		case <-tick:
+		}
 		//begin := time.Now()
 		for _, ch := range chs {
 			// TODO: Report jitter here. In
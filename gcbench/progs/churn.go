@@ -0,0 +1,104 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Test how the pacer reacts to changes in the allocation rate.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/aclements/go-gcbench/gcbench"
+	"github.com/aclements/go-gcbench/gcbench/heapgen"
+)
+
+var (
+	flagDuration     = flag.Duration("benchtime", 20*time.Second, "steady state duration")
+	flagBallast      = gcbench.FlagBytes("ballast", 64*gcbench.MB, "retain `x` bytes of ballast")
+	flagSchedule     = flag.String("schedule", "const:rate=64MB,dur=5s;ramp:from=64MB,to=512MB,dur=5s;burst:base=64MB,peak=512MB,period=1s,width=200ms,dur=5s;sine:mean=256MB,amp=192MB,period=2s,dur=5s", "allocation rate `schedule`: semicolon-separated const, ramp, burst, square and sine segments, or @file")
+	flagGoroutines   = flag.Int("goroutines", 4, "allocate from `n` goroutines")
+	flagBallastShape = flag.String("ballast-shape", "", "heap `shape` of the ballast, optionally with parameters (default a pointer-free []byte); one of\n"+heapgen.ShapeHelp())
+)
+
+var (
+	churner    gcbench.Churner
+	ballastGen func() interface{}
+)
+
+func main() {
+	memstats := new(runtime.MemStats)
+	start := time.Now()
+	flag.Parse()
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	schedule, err := gcbench.ParseRateSchedule(*flagSchedule)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *flagBallastShape != "" {
+		var err error
+		ballastGen, err = heapgen.Shape(*flagBallastShape)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
+	churner = gcbench.Churner{
+		BallastBytes: uint64(*flagBallast),
+		Schedule:     schedule,
+		Profile: &gcbench.AllocProfile{
+			Sizes:           []int{16, 64, 256, 1024},
+			PointerFraction: 0.5,
+			Burst:           64,
+		},
+		Goroutines:   *flagGoroutines,
+		AllocLatency: gcbench.NewLatencyDist(10*time.Nanosecond, time.Minute, 0.01),
+	}
+
+	b := gcbench.NewBenchmark("Churn", benchMain).Config("ballast", *flagBallast)
+	if *flagBallastShape != "" {
+		b.Config("ballast-shape", *flagBallastShape)
+	}
+	b.Config("schedule", *flagSchedule).Config("goroutines", *flagGoroutines).Run()
+	elapsed := time.Since(start)
+	fmt.Print("time: ", elapsed)
+	printMemStats(memstats)
+}
+
+func benchMain() {
+	if ballastGen != nil {
+		churner.Ballast, churner.BallastBytes = generateBallast(int(*flagBallast)), 0
+	}
+	churner.Start()
+	<-time.After(*flagDuration)
+	churner.Stop()
+}
+
+// generateBallast returns size bytes of ballast of the shape given by
+// -ballast-shape.
+func generateBallast(size int) interface{} {
+	m, err := heapgen.Measure(ballastGen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "measuring ballast: %v\n", err)
+		gcbench.ReportError(err)
+		os.Exit(1)
+	}
+	return heapgen.Generate(m.Gen, m.BytesRetained, size)
+}
+
+func printMemStats(memstats *runtime.MemStats) {
+	runtime.ReadMemStats(memstats)
+	fmt.Print(" | TotalAlloc ", memstats.TotalAlloc)
+	fmt.Print(" | mallocs ", memstats.Mallocs)
+	fmt.Print(" | frees ", memstats.Mallocs-memstats.Frees)
+	fmt.Println(" | GC cycles ", memstats.NumGC)
+}
@@ -36,11 +36,14 @@ func stack(id int) {
 }
 
 var (
-	flagDuration   = flag.Duration("benchtime", 10*time.Second, "steady state duration")
-	flagGs         = flag.Int("gs", 10000, "start `n` goroutines")
-	flagDirtyStack = gcbench.FlagBytes("dirty-stack", 10*gcbench.KB, "dirty approximately `bytes` of stack per goroutine each GC cycle")
+	flagDuration     = flag.Duration("benchtime", 10*time.Second, "steady state duration")
+	flagGs           = flag.Int("gs", 10000, "start `n` goroutines")
+	flagDirtyStack   = gcbench.FlagBytes("dirty-stack", 10*gcbench.KB, "dirty approximately `bytes` of stack per goroutine each GC cycle")
+	flagBallastShape = flag.String("ballast-shape", "AST", "heap `shape` of the ballast, optionally with parameters; one of\n"+heapgen.ShapeHelp())
 )
 
+var ballastGen func() interface{}
+
 func main() {
 	memstats := new(runtime.MemStats)
 	start := time.Now()
@@ -50,14 +53,31 @@ func main() {
 		os.Exit(2)
 	}
 
-	gcbench.NewBenchmark("DirtyStack", benchMain).Config("gs", *flagGs).Config("dirty-stack", *flagDirtyStack).Run()
+	ballastShape, err := heapgen.Shape(*flagBallastShape)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	ballastGen = ballastShape
+
+	b := gcbench.NewBenchmark("DirtyStack", benchMain).Config("gs", *flagGs).Config("dirty-stack", *flagDirtyStack)
+	if *flagBallastShape != "AST" {
+		b.Config("ballast-shape", *flagBallastShape)
+	}
+	b.Run()
 	elapsed := time.Since(start)
 	fmt.Print("time: ", elapsed)
 	printMemStats(memstats)
 }
 
 func benchMain() {
-	m := heapgen.Measure(heapgen.MakeAST)
+	m, err := heapgen.Measure(ballastGen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "measuring ballast: %v\n", err)
+		gcbench.ReportError(err)
+		os.Exit(1)
+	}
 	ballast = heapgen.Generate(m.Gen, m.BytesRetained, ballastSize)
 
 	for i := 0; i < *flagGs; i++ {
@@ -65,11 +85,11 @@ func benchMain() {
 	}
 
 	(&gcbench.Churner{
-		BytesPerSec: garbagePerSec,
+		BytesPerSec:  garbagePerSec,
+		AllocLatency: new(gcbench.LatencyDist),
 	}).Start()
 
 	time.Sleep(*flagDuration)
-	os.Exit(0)
 }
 
 func printMemStats(memstats *runtime.MemStats) {
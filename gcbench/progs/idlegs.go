@@ -13,6 +13,7 @@ import (
 	"fmt"
 
 	"github.com/aclements/go-gcbench/gcbench"
+	"github.com/aclements/go-gcbench/gcbench/heapgen"
 )
 
 const (
@@ -23,10 +24,13 @@ const (
 var (
 	flagDuration = flag.Duration("benchtime", 10*time.Second, "steady state duration")
 	// 5e5 Gs uses about 1.5GB of memory.
-	flagGs        = flag.Int("idle-gs", 5e5, "start `n` idle goroutines")
-	flagStackSize = gcbench.FlagBytes("stack-size", 0, "stack size")
+	flagGs           = flag.Int("idle-gs", 5e5, "start `n` idle goroutines")
+	flagStackSize    = gcbench.FlagBytes("stack-size", 0, "stack size")
+	flagBallastShape = flag.String("ballast-shape", "", "heap `shape` of the ballast, optionally with parameters (default a pointer-free []byte); one of\n"+heapgen.ShapeHelp())
 )
 
+var ballastGen func() interface{}
+
 func main() {
 	memstats := new(runtime.MemStats)
 	start := time.Now()
@@ -35,8 +39,21 @@ func main() {
 		flag.Usage()
 		os.Exit(2)
 	}
+	if *flagBallastShape != "" {
+		var err error
+		ballastGen, err = heapgen.Shape(*flagBallastShape)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
 
-	gcbench.NewBenchmark("IdleGs", benchMain).Config("idle-gs", *flagGs).Run()
+	b := gcbench.NewBenchmark("IdleGs", benchMain).Config("idle-gs", *flagGs)
+	if *flagBallastShape != "" {
+		b.Config("ballast-shape", *flagBallastShape)
+	}
+	b.Run()
 	elapsed := time.Since(start)
 	fmt.Print("time: ", elapsed)
 	printMemStats(memstats)
@@ -55,13 +72,29 @@ func benchMain() {
 		}
 	}
 
-	(&gcbench.Churner{
+	churner := &gcbench.Churner{
 		BallastBytes: ballastSize,
 		BytesPerSec:  garbagePerSec,
-	}).Start()
+		AllocLatency: new(gcbench.LatencyDist),
+	}
+	if ballastGen != nil {
+		churner.Ballast, churner.BallastBytes = generateBallast(ballastSize), 0
+	}
+	churner.Start()
+
+	time.Sleep(*flagDuration)
+}
 
-	time.AfterFunc(*flagDuration, func() { os.Exit(0) })
-	select {}
+// generateBallast returns size bytes of ballast of the shape given by
+// -ballast-shape.
+func generateBallast(size int) interface{} {
+	m, err := heapgen.Measure(ballastGen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "measuring ballast: %v\n", err)
+		gcbench.ReportError(err)
+		os.Exit(1)
+	}
+	return heapgen.Generate(m.Gen, m.BytesRetained, size)
 }
 
 func printMemStats(memstats *runtime.MemStats) {
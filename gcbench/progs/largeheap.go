@@ -10,7 +10,6 @@ import (
 	"fmt"
 	"os"
 	"runtime"
-	"sync/atomic"
 	"time"
 
 	"github.com/aclements/go-gcbench/gcbench"
@@ -22,11 +21,13 @@ var sink1, sink2 interface{}
 var (
 	flagDuration = flag.Duration("benchtime", 20*time.Second, "steady state duration")
 	flagRetain   = gcbench.FlagBytes("retain", gcbench.GB, "retain `x` bytes of heap")
-	flagHeap     = flag.String("heap", "AST", "heap `shape`; either \"AST\" or \"deBruijn2\"")
+	flagHeap     = flag.String("heap", "AST", "heap `shape`, optionally with parameters; one of\n"+heapgen.ShapeHelp())
+	flagSeed     = flag.Int64("seed", 0, "if non-zero, generate an identical retained heap on every run from `seed`, counting retained bytes by object size")
 	flagSTW      = flag.Bool("stw", false, "use STW GC")
+	flagInterval = flag.Duration("expected-interval", 0, "correct latency for coordinated omission assuming an iteration every `interval` (0 means estimate it)")
 )
 
-var heapMaker func() interface{}
+var heapMaker func(seed int64) interface{}
 
 func main() {
 	memstats := new(runtime.MemStats)
@@ -36,16 +37,10 @@ func main() {
 		flag.Usage()
 		os.Exit(2)
 	}
-	switch *flagHeap {
-	case "AST":
-		heapMaker = heapgen.MakeAST
-	case "deBruijn2":
-		heapMaker = func() interface{} {
-			// About 1MB per graph.
-			return heapgen.MakeDeBruijn2(16)
-		}
-	default:
-		fmt.Fprintf(os.Stderr, "unknown -heap shape %q\n", *flagHeap)
+	var err error
+	heapMaker, err = heapgen.SeededShape(*flagHeap)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
 		flag.Usage()
 		os.Exit(2)
 	}
@@ -55,28 +50,51 @@ func main() {
 		// This is a fairly different benchmark.
 		name += "STW"
 	}
-	gcbench.NewBenchmark(name, benchMain).Config("retain", *flagRetain).Config("heap", *flagHeap).Run()
+	b := gcbench.NewBenchmark(name, benchMain).Config("retain", *flagRetain).Config("heap", *flagHeap)
+	if *flagSeed != 0 {
+		b.Config("seed", *flagSeed)
+	}
+	b.Run()
 	elapsed := time.Since(start)
 	fmt.Print("time: ", elapsed)
 	printMemStats(memstats)
 }
 
 func benchMain() {
-	m := heapgen.Measure(heapMaker)
-	println(m.BytesRetained, "bytes per graph")
-	sink1 = heapgen.Generate(m.Gen, m.BytesRetained, int(*flagRetain))
+	m, err := heapgen.Measure(func() interface{} { return heapMaker(*flagSeed) })
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "measuring heap: %v\n", err)
+		gcbench.ReportError(err)
+		os.Exit(1)
+	}
+	println(m.BytesRetained, "bytes per graph, range", m.BytesRetainedLow, "-", m.BytesRetainedHigh, ";", m.ObjectBytesRetained, "bytes of objects")
+	if *flagSeed == 0 {
+		sink1 = heapgen.Generate(m.Gen, m.BytesRetained, int(*flagRetain))
+	} else {
+		// BytesRetained varies between runs, which would change
+		// the number of graphs.
+		sink1 = heapgen.GenerateSeeded(heapMaker, *flagSeed, m.ObjectBytesRetained, int(*flagRetain))
+	}
 
-	// TODO: Report more of the allocation time distribution.
+	// A long GC pause delays all of the iterations that would
+	// have run during it, so also record latency corrected for
+	// coordinated omission.
+	interval := *flagInterval
+	if interval == 0 {
+		interval = iterationTime(m.Gen)
+	}
 
 	// On my laptop for 1.5 and 1.6, this takes another ~10
 	// seconds to reach steady state.
-	var latDist gcbench.LatencyDist
+	var latDist, corrDist gcbench.LatencyDist
+	latSeries := gcbench.NewLatencySeries(100*time.Millisecond, 1024)
 	time.AfterFunc(*flagDuration, func() {
-		maxLat := atomic.LoadInt64((*int64)(&latDist.Max))
-		gcbench.ReportExtra("max-latency-ns", float64(maxLat))
+		gcbench.ReportLatency("latency", &latDist)
+		gcbench.ReportLatency("latency-corrected", &corrDist)
+		gcbench.ReportLatencySeries("latency", latSeries)
 		os.Exit(0)
 	})
-	lat := latDist.Start()
+	lat := latDist.StartCorrected(&corrDist, interval).WithSeries(latSeries)
 	for {
 		if *flagSTW {
 			runtime.GC()
@@ -88,6 +106,26 @@ func benchMain() {
 	lat.Done() // For completeness.
 }
 
+// iterationTime estimates the time of one iteration of the benchmark
+// loop without interference from the garbage collector.
+func iterationTime(gen func() interface{}) time.Duration {
+	if *flagSTW {
+		// Every iteration is a GC, so there's nothing to
+		// correct for.
+		return 0
+	}
+	// Take the fastest of several iterations.
+	var min time.Duration
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		sink2 = gen()
+		if t := time.Since(start); i == 0 || t < min {
+			min = t
+		}
+	}
+	return min
+}
+
 func printMemStats(memstats *runtime.MemStats) {
    runtime.ReadMemStats(memstats)
    fmt.Print(" | TotalAlloc ", memstats.TotalAlloc)
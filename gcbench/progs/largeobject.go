@@ -15,6 +15,7 @@ import (
 	"fmt"
 
 	"github.com/aclements/go-gcbench/gcbench"
+	"github.com/aclements/go-gcbench/gcbench/heapgen"
 )
 
 const (
@@ -29,13 +30,18 @@ var (
 	ballast     interface{}
 	workerSinks []interface{}
 	lat         gcbench.LatencyDist
+	// latCorrected is lat corrected for coordinated omission.
+	latCorrected gcbench.LatencyDist
 )
 
 var (
-	flagDuration = flag.Duration("benchtime", 10*time.Second, "steady state duration")
-	flagObjBytes = gcbench.FlagBytes("obj-size", 32*gcbench.MB, "large object size")
+	flagDuration     = flag.Duration("benchtime", 10*time.Second, "steady state duration")
+	flagObjBytes     = gcbench.FlagBytes("obj-size", 32*gcbench.MB, "large object size")
+	flagBallastShape = flag.String("ballast-shape", "", "heap `shape` of the ballast, optionally with parameters (default large objects of obj-size); one of\n"+heapgen.ShapeHelp())
 )
 
+var ballastGen func() interface{}
+
 func main() {
 	memstats := new(runtime.MemStats)
 	start := time.Now()
@@ -45,8 +51,21 @@ func main() {
 		flag.Usage()
 		os.Exit(2)
 	}
+	if *flagBallastShape != "" {
+		var err error
+		ballastGen, err = heapgen.Shape(*flagBallastShape)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
 
-	gcbench.NewBenchmark("LargeObject", benchMain).Config("obj-size", *flagObjBytes).Run()
+	b := gcbench.NewBenchmark("LargeObject", benchMain).Config("obj-size", *flagObjBytes)
+	if *flagBallastShape != "" {
+		b.Config("ballast-shape", *flagBallastShape)
+	}
+	b.Run()
 	elapsed := time.Since(start)
 	fmt.Print("time: ", elapsed)
 	printMemStats(memstats)
@@ -60,9 +79,14 @@ func benchMain() {
 	}
 
 	// Create the ballast. uintptrs already took 2*objectBytes bytes.
-	b := make([][]*uintptr, (ballastBytes-2*(*flagObjBytes))/(*flagObjBytes))
-	for i := range b {
-		b[i] = makeBigObject()
+	if ballastGen != nil {
+		ballast = generateBallast(ballastBytes - 2*int(*flagObjBytes))
+	} else {
+		b := make([][]*uintptr, (ballastBytes-2*(*flagObjBytes))/(*flagObjBytes))
+		for i := range b {
+			b[i] = makeBigObject()
+		}
+		ballast = b
 	}
 
 	// Run workers, which allocate to force GC and perform
@@ -75,9 +99,8 @@ func benchMain() {
 	time.Sleep(*flagDuration)
 
 	lat.FprintHist(os.Stderr, 70, 5)
-	gcbench.ReportExtra("P99-latency-ns", float64(lat.Quantile(0.99)))
-	gcbench.ReportExtra("P99.9-latency-ns", float64(lat.Quantile(0.999)))
-	gcbench.ReportExtra("max-latency-ns", float64(lat.Max))
+	gcbench.ReportLatency("latency", &lat)
+	gcbench.ReportLatency("latency-corrected", &latCorrected)
 }
 
 func makeBigObject() []*uintptr {
@@ -91,11 +114,25 @@ func worker(id int) {
 	for {
 		t := time.Now()
 		workerSinks[id] = make([]byte, garbagePerSec/allocsPerSec/len(workerSinks))
-		lat.Add(time.Since(t))
+		d := time.Since(t)
+		lat.Add(d)
+		latCorrected.AddCorrected(d, time.Second/allocsPerSec)
 		time.Sleep(time.Second / allocsPerSec)
 	}
 }
 
+// generateBallast returns size bytes of ballast of the shape given by
+// -ballast-shape.
+func generateBallast(size int) interface{} {
+	m, err := heapgen.Measure(ballastGen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "measuring ballast: %v\n", err)
+		gcbench.ReportError(err)
+		os.Exit(1)
+	}
+	return heapgen.Generate(m.Gen, m.BytesRetained, size)
+}
+
 func printMemStats(memstats *runtime.MemStats) {
    runtime.ReadMemStats(memstats)
    fmt.Print(" | TotalAlloc ", memstats.TotalAlloc)
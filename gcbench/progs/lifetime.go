@@ -0,0 +1,104 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Test the pacer with objects that live for a while and then die, as
+// in caches and session state.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/aclements/go-gcbench/gcbench"
+	"github.com/aclements/go-gcbench/gcbench/heapgen"
+)
+
+var (
+	flagDuration = flag.Duration("benchtime", 20*time.Second, "steady state duration")
+	flagLive     = gcbench.FlagBytes("live", 256*gcbench.MB, "keep about `x` bytes of heap live")
+	flagLifetime = flag.String("lifetime", "bimodal", "object lifetime `distribution`: exp, bimodal or pareto, optionally with parameters as in exp:mean=100ms")
+	flagObject   = flag.String("object", "", "object heap `shape` (default 64-byte objects)")
+	flagSeed     = flag.Int64("seed", 1, "seed lifetimes with `seed`")
+)
+
+var lifetimeHeap heapgen.LifetimeHeap
+
+func main() {
+	memstats := new(runtime.MemStats)
+	start := time.Now()
+	flag.Parse()
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	lifetime, err := heapgen.ParseLifetime(*flagLifetime)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	lifetimeHeap = heapgen.LifetimeHeap{
+		Lifetime:  lifetime,
+		LiveBytes: int(*flagLive),
+		Seed:      *flagSeed,
+	}
+	if *flagObject != "" {
+		lifetimeHeap.Gen, err = heapgen.Shape(*flagObject)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
+
+	b := gcbench.NewBenchmark("Lifetime", benchMain).Config("live", *flagLive).Config("lifetime", *flagLifetime)
+	if *flagObject != "" {
+		b.Config("object", *flagObject)
+	}
+	b.Run()
+	elapsed := time.Since(start)
+	fmt.Print("time: ", elapsed)
+	printMemStats(memstats)
+}
+
+func benchMain() {
+	if err := lifetimeHeap.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "measuring objects: %v\n", err)
+		gcbench.ReportError(err)
+		os.Exit(1)
+	}
+	// Sample the live heap to report the achieved size, which
+	// falls short of the target if allocation can't keep up.
+	start := time.Now()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	deadline := time.After(*flagDuration)
+	var liveSum, samples float64
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			liveSum += float64(lifetimeHeap.Live())
+			samples++
+		case <-deadline:
+			break loop
+		}
+	}
+	ticker.Stop()
+	if samples > 0 {
+		gcbench.ReportExtra("lifetime-live-MB", liveSum/samples/1e6)
+	}
+	gcbench.ReportExtra("lifetime-alloc-MB/sec", float64(lifetimeHeap.Allocated())/1e6/time.Since(start).Seconds())
+	os.Exit(0)
+}
+
+func printMemStats(memstats *runtime.MemStats) {
+	runtime.ReadMemStats(memstats)
+	fmt.Print(" | TotalAlloc ", memstats.TotalAlloc)
+	fmt.Print(" | mallocs ", memstats.Mallocs)
+	fmt.Print(" | frees ", memstats.Mallocs-memstats.Frees)
+	fmt.Println(" | GC cycles ", memstats.NumGC)
+}
@@ -38,13 +38,16 @@ import (
 )
 
 var (
-	flagDuration = flag.Duration("benchtime", 10*time.Second, "steady state duration")
-	flagBallast  = gcbench.FlagBytes("ballast", 64*gcbench.MB, "retain `x` bytes of global data")
+	flagDuration     = flag.Duration("benchtime", 10*time.Second, "steady state duration")
+	flagBallast      = gcbench.FlagBytes("ballast", 64*gcbench.MB, "retain `x` bytes of global data")
+	flagBallastShape = flag.String("ballast-shape", "AST", "heap `shape` of the ballast, optionally with parameters; one of\n"+heapgen.ShapeHelp())
 	// XXX Make this reqs-per-sec-per-p so it scales properly.
 	flagReqsPerSec = flag.Float64("reqs-per-sec", 8000, "send `rate` requests per second")
 	flagClient     = flag.String("client", "", "internal flag to act as RPC client")
 )
 
+var ballastGen func() interface{}
+
 func main() {
 	memstats := new(runtime.MemStats)
 	start := time.Now()
@@ -59,8 +62,20 @@ func main() {
 		return
 	}
 
+	ballastShape, err := heapgen.Shape(*flagBallastShape)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	ballastGen = ballastShape
+
 	name := "RPC"
-	gcbench.NewBenchmark(name, benchMain).Config("reqs-per-sec", *flagReqsPerSec).Config("ballast", *flagBallast).Run()
+	b := gcbench.NewBenchmark(name, benchMain).Config("reqs-per-sec", *flagReqsPerSec).Config("ballast", *flagBallast)
+	if *flagBallastShape != "AST" {
+		b.Config("ballast-shape", *flagBallastShape)
+	}
+	b.Run()
 	elapsed := time.Since(start)
 	fmt.Print("time: ", elapsed)
 	printMemStats(memstats)
@@ -70,10 +85,16 @@ func main() {
 var sink1 interface{}
 var requestCount int64
 var serverLatency gcbench.LatencyDist
+var serverSeries = gcbench.NewLatencySeries(100*time.Millisecond, 1024)
 
 func benchMain() {
 	// Create the ballast.
-	m := heapgen.Measure(heapgen.MakeAST)
+	m, err := heapgen.Measure(ballastGen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "measuring ballast: %v\n", err)
+		gcbench.ReportError(err)
+		os.Exit(1)
+	}
 	sink1 = heapgen.Generate(m.Gen, m.BytesRetained, int(*flagBallast))
 
 	// Divide GOMAXPROCS by two so it's split between client and
@@ -88,6 +109,9 @@ func benchMain() {
 	client := exec.Command(os.Args[0], "-client", l.Addr().String(), "-reqs-per-sec", fmt.Sprint(*flagReqsPerSec))
 	client.Env = []string{"GODEBUG=gctrace=1", "GOGC=off",
 		fmt.Sprintf("GOMAXPROCS=%d", gomaxprocs/2)}
+	// The client reports its latency metrics directly to the
+	// harness.
+	gcbench.ForwardReports(client)
 	cin, err := client.StdinPipe()
 	if err != nil {
 		log.Fatal("creating client stdin pipe: ", err)
@@ -114,6 +138,8 @@ func benchMain() {
 		// Server-reported latency.
 		fmt.Fprintf(os.Stderr, "server-measured request latency:\n")
 		serverLatency.FprintHist(os.Stderr, 70, 5)
+		gcbench.ReportLatency("server-latency", &serverLatency)
+		gcbench.ReportLatencySeries("server-latency", serverSeries)
 
 		// Shut down client.
 		cin.Close()
@@ -157,7 +183,7 @@ func handler(c net.Conn) {
 			c.Close()
 			return
 		}
-		lt := serverLatency.Start()
+		lt := serverLatency.Start().WithSeries(serverSeries)
 		if n != 1 || header[0] != 'x' {
 			log.Fatal("bad header: ", n, err, header)
 		}
@@ -201,9 +227,7 @@ func doClient(addr string) {
 		}
 		fmt.Fprintln(os.Stderr, "client-measured request latency:")
 		lat.FprintHist(os.Stderr, 70, 5)
-		gcbench.ReportExtra("P99-latency-ns", float64(lat.Quantile(0.99)))
-		gcbench.ReportExtra("P99.9-latency-ns", float64(lat.Quantile(0.999)))
-		gcbench.ReportExtra("max-latency-ns", float64(lat.Max))
+		gcbench.ReportLatency("latency", &lat)
 		//log.Print("client exiting")
 		os.Exit(0)
 	}()
@@ -16,6 +16,7 @@ import (
 	"fmt"
 
 	"github.com/aclements/go-gcbench/gcbench"
+	"github.com/aclements/go-gcbench/gcbench/heapgen"
 )
 
 const (
@@ -39,12 +40,15 @@ func stack(phase, a, b *sync.WaitGroup) {
 }
 
 var (
-	flagDuration = flag.Duration("benchtime", 20*time.Second, "steady state duration")
-	flagGs       = flag.Int("gs", 10000, "start `n` goroutines")
-	flagLow      = gcbench.FlagBytes("low", 0, "retain approximately `bytes` of stack")
-	flagHigh     = gcbench.FlagBytes("high", 10*gcbench.KB, "grow to approximately `bytes` of stack")
+	flagDuration     = flag.Duration("benchtime", 20*time.Second, "steady state duration")
+	flagGs           = flag.Int("gs", 10000, "start `n` goroutines")
+	flagLow          = gcbench.FlagBytes("low", 0, "retain approximately `bytes` of stack")
+	flagHigh         = gcbench.FlagBytes("high", 10*gcbench.KB, "grow to approximately `bytes` of stack")
+	flagBallastShape = flag.String("ballast-shape", "", "heap `shape` of the ballast, optionally with parameters (default a pointer-free []byte); one of\n"+heapgen.ShapeHelp())
 )
 
+var ballastGen func() interface{}
+
 func main() {
 	memstats := new(runtime.MemStats)
 	start := time.Now()
@@ -54,8 +58,21 @@ func main() {
 		flag.Usage()
 		os.Exit(2)
 	}
+	if *flagBallastShape != "" {
+		var err error
+		ballastGen, err = heapgen.Shape(*flagBallastShape)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
 
-	gcbench.NewBenchmark("StackShrink", benchMain).Config("gs", *flagGs).Config("low", *flagLow).Config("high", *flagHigh).Run()
+	b := gcbench.NewBenchmark("StackShrink", benchMain).Config("gs", *flagGs).Config("low", *flagLow).Config("high", *flagHigh)
+	if *flagBallastShape != "" {
+		b.Config("ballast-shape", *flagBallastShape)
+	}
+	b.Run()
 	elapsed := time.Since(start)
 	fmt.Print("time: ", elapsed)
 	printMemStats(memstats)
@@ -67,6 +84,9 @@ func benchMain() {
 		BallastBytes: ballastSize,
 		BytesPerSec:  garbagePerSec,
 	}
+	if ballastGen != nil {
+		churn.Ballast, churn.BallastBytes = generateBallast(ballastSize), 0
+	}
 
 	var phase, a, b sync.WaitGroup
 	phase.Add(*flagGs)
@@ -77,9 +97,7 @@ func benchMain() {
 	// Wait for all stacks to be big.
 	phase.Wait()
 
-	time.AfterFunc(*flagDuration, func() { os.Exit(0) })
-
-	for {
+	for start := time.Now(); time.Since(start) < *flagDuration; {
 		// Shrink all stacks.
 		phase.Add(*flagGs)
 		b.Add(1)
@@ -107,6 +125,18 @@ func benchMain() {
 	}
 }
 
+// generateBallast returns size bytes of ballast of the shape given by
+// -ballast-shape.
+func generateBallast(size int) interface{} {
+	m, err := heapgen.Measure(ballastGen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "measuring ballast: %v\n", err)
+		gcbench.ReportError(err)
+		os.Exit(1)
+	}
+	return heapgen.Generate(m.Gen, m.BytesRetained, size)
+}
+
 func printMemStats(memstats *runtime.MemStats) {
    runtime.ReadMemStats(memstats)
    fmt.Print(" | TotalAlloc ", memstats.TotalAlloc)
@@ -45,4 +45,14 @@ for i in `seq 1 30`; do
 	GOMAXPROCS=1 go run dirtystack.go >> dirtystack_log.txt
 done
 
+for i in `seq 1 30`; do
+	echo " $i lifetime " >> lifetime_log.txt
+	GOMAXPROCS=1 go run lifetime.go >> lifetime_log.txt
+done
+
+for i in `seq 1 30`; do
+	echo " $i churn " >> churn_log.txt
+	GOMAXPROCS=1 go run churn.go >> churn_log.txt
+done
+
 echo "\n ThEnd"
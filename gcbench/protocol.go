@@ -0,0 +1,260 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcbench
+
+// A benchmark process reports results to the harness as a stream of
+// JSON messages written to a dedicated file descriptor. The harness
+// passes the descriptor number to the benchmark in the
+// GCBENCH_REPORT_FD environment variable. This keeps reports separate
+// from stderr, which carries the gctrace, panics, and anything the
+// benchmark itself prints.
+//
+// Benchmarks that run part of their workload in a subprocess share
+// the descriptor with it, and pipe writes are only atomic up to
+// PIPE_BUF bytes, so messages are split into frames that each fit in
+// a single write. Each frame is a header line
+//
+//	<writer> <length> <more>
+//
+// followed by length bytes of the message, where writer identifies
+// the writing process and more is 1 if the message continues in the
+// next frame from the same writer and 0 if this is its last frame.
+// Frames from different writers may interleave, so the harness
+// reassembles each message from the frames of its writer.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const reportFDEnv = "GCBENCH_REPORT_FD"
+
+// processStart approximates the time this process started. Phase
+// times are relative to this so they can be compared with gctrace
+// times, which are relative to when the runtime started.
+var processStart = time.Now()
+
+// message is a single report from a benchmark process to the
+// harness.
+type message struct {
+	// Kind is the kind of report: "metric", "phase", "latency",
+	// "latency-series", or "error".
+	Kind string
+
+	// Name is the name of the metric, phase, latency
+	// distribution, or latency series.
+	Name string `json:",omitempty"`
+
+	// Value is the value of a metric.
+	Value float64 `json:",omitempty"`
+
+	// Time is the time a phase began, relative to when the
+	// benchmark process started.
+	Time time.Duration `json:",omitempty"`
+
+	// Latency is a latency distribution.
+	Latency *LatencyDist `json:",omitempty"`
+
+	// Series is a latency series.
+	Series *LatencySeries `json:",omitempty"`
+
+	// Error is the text of an error report.
+	Error string `json:",omitempty"`
+}
+
+// Phase is a named phase of a benchmark run, as reported by
+// ReportPhase.
+type Phase struct {
+	Name string
+
+	// Start is the time this phase began, relative to when the
+	// benchmark process started.
+	Start time.Duration
+}
+
+var reporter struct {
+	once sync.Once
+	sync.Mutex
+	f *os.File
+}
+
+// reportFile returns the report file passed by the harness, or nil
+// if this process is not running under the harness.
+func reportFile() *os.File {
+	reporter.once.Do(func() {
+		s := os.Getenv(reportFDEnv)
+		if s == "" {
+			return
+		}
+		fd, err := strconv.Atoi(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bad %s %q\n", reportFDEnv, s)
+			os.Exit(1)
+		}
+		reporter.f = os.NewFile(uintptr(fd), "gcbench-report")
+	})
+	return reporter.f
+}
+
+// sendMessage sends m to the harness. If this process isn't running
+// under the harness, it prints m to stderr instead.
+func sendMessage(m *message) {
+	f := reportFile()
+	if f == nil {
+		switch m.Kind {
+		case "metric":
+			fmt.Fprintf(os.Stderr, "metric %v %s\n", m.Value, m.Name)
+		case "phase":
+			fmt.Fprintf(os.Stderr, "phase %s @%s\n", m.Name, m.Time)
+		case "latency":
+			fmt.Fprintf(os.Stderr, "%s:\n", m.Name)
+			m.Latency.FprintHist(os.Stderr, 70, 5)
+		case "latency-series":
+			fmt.Fprintf(os.Stderr, "%s:\n", m.Name)
+			m.Series.FprintGCReport(os.Stderr, nil)
+		case "error":
+			fmt.Fprintf(os.Stderr, "error: %s\n", m.Error)
+		}
+		return
+	}
+
+	reporter.Lock()
+	defer reporter.Unlock()
+	if err := writeMessage(f, os.Getpid(), m); err != nil {
+		fmt.Fprintf(os.Stderr, "writing report: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// maxFrame is the largest frame writeMessage writes. POSIX requires
+// PIPE_BUF to be at least 512 bytes, and it is 4096 on Linux.
+const maxFrame = 4096
+
+// writeMessage writes m to w as frames from the given writer, using a
+// single Write for each frame.
+func writeMessage(w io.Writer, writer int, m *message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	frame := make([]byte, 0, maxFrame)
+	for {
+		// Leave room for the longest header.
+		n := maxFrame - len(fmt.Sprintf("%d %d 1\n", writer, maxFrame))
+		more := 1
+		if n >= len(data) {
+			n, more = len(data), 0
+		}
+		frame = append(frame[:0], fmt.Sprintf("%d %d %d\n", writer, n, more)...)
+		frame = append(frame, data[:n]...)
+		if _, err := w.Write(frame); err != nil {
+			return err
+		}
+		data = data[n:]
+		if more == 0 {
+			return nil
+		}
+	}
+}
+
+// ReportExtra can be used by a benchmark main function to report
+// extra metrics.
+func ReportExtra(metric string, val float64) {
+	sendMessage(&message{Kind: "metric", Name: metric, Value: val})
+}
+
+// ReportLatency reports the latency distribution d under the given
+// name. The harness derives quantile metrics from d and records the
+// full distribution in its JSON output. It is safe to call
+// ReportLatency while other goroutines are adding to d.
+func ReportLatency(name string, d *LatencyDist) {
+	sendMessage(&message{Kind: "latency", Name: name, Latency: d})
+}
+
+// ReportLatencySeries reports the latency series s under the given
+// name. The harness joins s with the GC trace to derive latency
+// metrics for intervals during and outside of GC, and records the
+// full series in its JSON output. It is safe to call
+// ReportLatencySeries while other goroutines are adding to s.
+func ReportLatencySeries(name string, s *LatencySeries) {
+	sendMessage(&message{Kind: "latency-series", Name: name, Series: s})
+}
+
+// ReportPhase marks the beginning of a new phase of the benchmark.
+// The phase continues until the next call to ReportPhase.
+func ReportPhase(name string) {
+	sendMessage(&message{Kind: "phase", Name: name, Time: time.Since(processStart)})
+}
+
+// ReportError reports that the benchmark failed. The harness will
+// discard the results of this run. ReportError does not exit.
+func ReportError(err error) {
+	sendMessage(&message{Kind: "error", Error: err.Error()})
+}
+
+// ForwardReports arranges for cmd to send its reports to this
+// process's harness. This can be used by benchmarks that run part of
+// their workload in a subprocess. It must be called before cmd is
+// started.
+func ForwardReports(cmd *exec.Cmd) {
+	f := reportFile()
+	if f == nil {
+		return
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	// Extra files start at descriptor 3 in the child.
+	fd := 3 + len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", reportFDEnv, fd))
+}
+
+// readMessages reads frames from r until EOF and returns the
+// messages they contain in the order each message was completed.
+func readMessages(r io.Reader) ([]message, error) {
+	var msgs []message
+	br := bufio.NewReader(r)
+	partial := make(map[int][]byte)
+	for {
+		hdr, err := br.ReadString('\n')
+		if err == io.EOF && hdr == "" {
+			break
+		} else if err != nil {
+			return msgs, fmt.Errorf("reading report frame: %v", err)
+		}
+		var writer, n, more int
+		if _, err := fmt.Sscanf(hdr, "%d %d %d\n", &writer, &n, &more); err != nil || n < 0 || n > maxFrame {
+			return msgs, fmt.Errorf("bad report frame header %q", hdr)
+		}
+		buf := partial[writer]
+		start := len(buf)
+		buf = append(buf, make([]byte, n)...)
+		if _, err := io.ReadFull(br, buf[start:]); err != nil {
+			return msgs, fmt.Errorf("reading report frame: %v", err)
+		}
+		if more != 0 {
+			partial[writer] = buf
+			continue
+		}
+		delete(partial, writer)
+		var m message
+		if err := json.Unmarshal(buf, &m); err != nil {
+			return msgs, fmt.Errorf("decoding report: %v", err)
+		}
+		msgs = append(msgs, m)
+	}
+	if len(partial) != 0 {
+		return msgs, fmt.Errorf("report stream ended in the middle of a message")
+	}
+	return msgs, nil
+}
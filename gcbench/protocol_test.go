@@ -0,0 +1,95 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcbench
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// frameRecorder records each Write as a separate frame.
+type frameRecorder [][]byte
+
+func (r *frameRecorder) Write(b []byte) (int, error) {
+	*r = append(*r, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func TestProtocolRoundTrip(t *testing.T) {
+	d := new(LatencyDist)
+	for i := 1; i <= 10000; i++ {
+		d.Add(time.Duration(i) * time.Microsecond)
+	}
+	big := []*message{
+		{Kind: "latency", Name: "server", Latency: d},
+		{Kind: "error", Error: strings.Repeat("x", 3*maxFrame)},
+	}
+	small := []*message{
+		{Kind: "metric", Name: "client-metric", Value: 42},
+		{Kind: "phase", Name: "warmup", Time: time.Second},
+	}
+
+	// Record the frames of two writers, as if they were separate
+	// processes sharing the report descriptor.
+	var frames [2]frameRecorder
+	for i, msgs := range [][]*message{big, small} {
+		for _, m := range msgs {
+			if err := writeMessage(&frames[i], 100+i, m); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, f := range frames[0] {
+		if len(f) > maxFrame {
+			t.Fatalf("frame of %d bytes exceeds maxFrame", len(f))
+		}
+	}
+	if len(frames[0]) < 4 {
+		t.Fatalf("large messages wrote only %d frames", len(frames[0]))
+	}
+
+	// Interleave the frames of the two writers.
+	var stream bytes.Buffer
+	for i := 0; i < len(frames[0]) || i < len(frames[1]); i++ {
+		for _, f := range frames {
+			if i < len(f) {
+				stream.Write(f[i])
+			}
+		}
+	}
+
+	msgs, err := readMessages(&stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]message)
+	for _, m := range msgs {
+		byName[m.Kind+"/"+m.Name] = m
+	}
+	if len(msgs) != 4 || len(byName) != 4 {
+		t.Fatalf("read %d messages, want 4", len(msgs))
+	}
+	if m := byName["latency/server"]; m.Latency == nil || m.Latency.N != d.N || m.Latency.Quantile(0.5) != d.Quantile(0.5) {
+		t.Errorf("latency distribution did not round-trip")
+	}
+	if m := byName["error/"]; m.Error != big[1].Error {
+		t.Errorf("error of %d bytes read back as %d bytes", len(big[1].Error), len(m.Error))
+	}
+	if m := byName["metric/client-metric"]; m.Value != 42 {
+		t.Errorf("metric read back as %v, want 42", m.Value)
+	}
+	if m := byName["phase/warmup"]; m.Time != time.Second {
+		t.Errorf("phase time read back as %v, want 1s", m.Time)
+	}
+
+	// A stream that ends mid-message is an error.
+	var trunc frameRecorder
+	writeMessage(&trunc, 1, big[1])
+	if _, err := readMessages(bytes.NewReader(trunc[0])); err == nil {
+		t.Errorf("truncated stream: want error")
+	}
+}
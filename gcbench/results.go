@@ -0,0 +1,106 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcbench
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var flagJSON = flag.String("json", "", "append results, including latency distributions, as JSON to `file`")
+var flagLatencyPctiles = flag.String("latency-percentiles", "50,99,99.9", "report latency distributions at `percentiles`")
+var flagLatencyReport = flag.Bool("latency-report", false, "print per-interval latency and overlapping GC cycles of latency series")
+
+// RunResult is the JSON record of a single benchmark run.
+type RunResult struct {
+	// Name is the full name of the benchmark, including its
+	// configuration.
+	Name string
+
+	// Result is the set of (unit, value) metrics for this run.
+	Result map[string]float64
+
+	// Latency is the set of latency distributions reported by
+	// the benchmark, by name.
+	Latency map[string]*LatencyDist `json:",omitempty"`
+
+	// LatencySeries is the set of latency series reported by the
+	// benchmark, by name.
+	LatencySeries map[string]*LatencySeries `json:",omitempty"`
+
+	// Trace is the GC trace of the run.
+	Trace GCTrace
+
+	// Phases is the sequence of phases reported by the benchmark.
+	Phases []Phase `json:",omitempty"`
+}
+
+// ReadRunResults reads the RunResults written to a -json file.
+func ReadRunResults(r io.Reader) ([]*RunResult, error) {
+	var out []*RunResult
+	dec := json.NewDecoder(r)
+	for {
+		res := new(RunResult)
+		err := dec.Decode(res)
+		if err == io.EOF {
+			return out, nil
+		} else if err != nil {
+			return nil, err
+		}
+		out = append(out, res)
+	}
+}
+
+// writeJSON appends r to the -json file, if any.
+func (r *RunResult) writeJSON() error {
+	if *flagJSON == "" {
+		return nil
+	}
+	f, err := os.OpenFile(*flagJSON, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// latencyMetrics adds the -latency-percentiles of d and its maximum
+// to extra as metrics named for the distribution.
+func latencyMetrics(extra map[string]float64, name string, d *LatencyDist) error {
+	if d.N == 0 {
+		return nil
+	}
+	for _, pct := range strings.Split(*flagLatencyPctiles, ",") {
+		pct = strings.TrimSpace(pct)
+		if pct == "" {
+			continue
+		}
+		p, err := strconv.ParseFloat(pct, 64)
+		if err != nil || p < 0 || p > 100 {
+			return fmt.Errorf("bad -latency-percentiles percentile %q", pct)
+		}
+		extra[fmt.Sprintf("P%s-%s-ns", pct, name)] = float64(d.Quantile(p / 100))
+	}
+	extra[fmt.Sprintf("max-%s-ns", name)] = float64(d.Max)
+	return nil
+}
+
+// seriesMetrics adds latency metrics for the intervals of s that do
+// and don't overlap a GC cycle to extra.
+func seriesMetrics(extra map[string]float64, name string, s *LatencySeries, trace GCTrace) error {
+	inGC, outGC := s.SplitGC(trace)
+	if err := latencyMetrics(extra, name+"-inGC", inGC); err != nil {
+		return err
+	}
+	return latencyMetrics(extra, name+"-outGC", outGC)
+}
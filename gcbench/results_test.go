@@ -0,0 +1,52 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcbench
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestLatencyMetrics(t *testing.T) {
+	d := new(LatencyDist)
+	for i := 1; i <= 1000; i++ {
+		d.Add(time.Duration(i) * time.Microsecond)
+	}
+
+	extra := map[string]float64{}
+	if err := latencyMetrics(extra, "latency", d); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for name := range extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{"P50-latency-ns", "P99-latency-ns", "P99.9-latency-ns", "max-latency-ns"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("metrics are %v, want %v", names, want)
+	}
+	if got := extra["max-latency-ns"]; got != 1e6 {
+		t.Errorf("max-latency-ns = %v, want 1e6", got)
+	}
+	if got := extra["P99-latency-ns"]; got != float64(d.Quantile(0.99)) {
+		t.Errorf("P99-latency-ns = %v, want %v", got, float64(d.Quantile(0.99)))
+	}
+
+	// An empty distribution has no metrics.
+	extra = map[string]float64{}
+	if err := latencyMetrics(extra, "empty", new(LatencyDist)); err != nil || len(extra) != 0 {
+		t.Errorf("empty distribution gave metrics %v, error %v", extra, err)
+	}
+
+	old := *flagLatencyPctiles
+	defer func() { *flagLatencyPctiles = old }()
+	*flagLatencyPctiles = "90, 200"
+	if err := latencyMetrics(map[string]float64{}, "latency", d); err == nil {
+		t.Errorf("percentile 200: want error")
+	}
+}
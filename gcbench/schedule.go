@@ -0,0 +1,215 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcbench
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+	"time"
+)
+
+// A RateSchedule gives an allocation rate that varies over time. It
+// is a sequence of segments that repeats once the last segment ends.
+type RateSchedule []RateSegment
+
+// A RateSegment is one segment of a RateSchedule.
+type RateSegment struct {
+	// Name is the name of the phase reported when this segment
+	// begins.
+	Name string
+
+	// Duration is the length of this segment.
+	Duration time.Duration
+
+	// Rate returns the allocation rate in bytes per second at
+	// time t into this segment.
+	Rate func(t time.Duration) float64
+}
+
+// Rate returns the allocation rate in bytes per second at time t
+// into s.
+func (s RateSchedule) Rate(t time.Duration) float64 {
+	seg, t := s.segment(t)
+	return s[seg].Rate(t)
+}
+
+// segment returns the index of the segment containing time t into s
+// and the time into that segment.
+func (s RateSchedule) segment(t time.Duration) (int, time.Duration) {
+	var total time.Duration
+	for _, seg := range s {
+		total += seg.Duration
+	}
+	if total <= 0 {
+		panic("RateSchedule has no duration")
+	}
+	t %= total
+	for i, seg := range s {
+		if t < seg.Duration {
+			return i, t
+		}
+		t -= seg.Duration
+	}
+	panic("not reached")
+}
+
+// ParseRateSchedule parses a rate schedule. spec is a
+// semicolon-separated list of segments or, if it begins with "@", the
+// name of a file containing one segment per line, where "#" starts a
+// comment. Each segment has the form "kind:param=value,...". The kinds
+// of segment are
+//
+//	const:rate=R                           constant rate R
+//	ramp:from=R1,to=R2                     linear ramp from R1 to R2
+//	burst:base=R1,peak=R2,period=P,width=W R2 for the first W of every P, otherwise R1
+//	square:low=R1,high=R2,period=P         R2 for the first half of every P, otherwise R1
+//	sine:mean=R,amp=A,period=P             sine wave around R with amplitude A
+//
+// where rates are bytes per second such as "64MB" and periods are
+// durations such as "500ms". A sequence of const segments gives a
+// step function. Every segment also takes a dur=D param, which is
+// required, and a name=N param, which names the phase reported when
+// the segment begins and defaults to the kind and index of the
+// segment, such as "ramp1".
+func ParseRateSchedule(spec string) (RateSchedule, error) {
+	var segs []string
+	if strings.HasPrefix(spec, "@") {
+		data, err := ioutil.ReadFile(spec[1:])
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if i := strings.Index(line, "#"); i >= 0 {
+				line = line[:i]
+			}
+			if line = strings.TrimSpace(line); line != "" {
+				segs = append(segs, line)
+			}
+		}
+	} else {
+		for _, seg := range strings.Split(spec, ";") {
+			if seg = strings.TrimSpace(seg); seg != "" {
+				segs = append(segs, seg)
+			}
+		}
+	}
+	if len(segs) == 0 {
+		return nil, fmt.Errorf("rate schedule %q has no segments", spec)
+	}
+	var s RateSchedule
+	for i, seg := range segs {
+		rs, err := parseRateSegment(seg, i)
+		if err != nil {
+			return nil, fmt.Errorf("rate schedule segment %q: %v", seg, err)
+		}
+		s = append(s, rs)
+	}
+	return s, nil
+}
+
+// rateParams lists the params of each kind of segment, other than
+// dur and name.
+var rateParams = map[string][]string{
+	"const":  {"rate"},
+	"ramp":   {"from", "to"},
+	"burst":  {"base", "peak", "period", "width"},
+	"square": {"low", "high", "period"},
+	"sine":   {"mean", "amp", "period"},
+}
+
+func parseRateSegment(seg string, index int) (RateSegment, error) {
+	kind, rest := seg, ""
+	if i := strings.Index(seg, ":"); i >= 0 {
+		kind, rest = seg[:i], seg[i+1:]
+	}
+	names, ok := rateParams[kind]
+	if !ok {
+		return RateSegment{}, fmt.Errorf("unknown kind %q", kind)
+	}
+	rs := RateSegment{Name: fmt.Sprintf("%s%d", kind, index)}
+	rates := map[string]float64{}
+	durs := map[string]time.Duration{}
+	for _, setting := range strings.Split(rest, ",") {
+		if setting == "" {
+			continue
+		}
+		i := strings.Index(setting, "=")
+		if i < 0 {
+			return RateSegment{}, fmt.Errorf("expected param=value, got %q", setting)
+		}
+		k, v := setting[:i], setting[i+1:]
+		known := k == "dur" || k == "name"
+		for _, name := range names {
+			known = known || k == name
+		}
+		if !known {
+			return RateSegment{}, fmt.Errorf("unknown param %q", k)
+		}
+		switch k {
+		case "name":
+			rs.Name = v
+		case "dur", "period", "width":
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return RateSegment{}, fmt.Errorf("bad value %q for %s", v, k)
+			}
+			durs[k] = d
+		default:
+			b, err := ParseBytes(v)
+			if err != nil || b < 0 {
+				return RateSegment{}, fmt.Errorf("bad value %q for %s", v, k)
+			}
+			rates[k] = float64(b)
+		}
+	}
+	if _, ok := durs["dur"]; !ok {
+		return RateSegment{}, fmt.Errorf("missing dur")
+	}
+	for _, name := range names {
+		_, ok1 := rates[name]
+		_, ok2 := durs[name]
+		if !ok1 && !ok2 {
+			return RateSegment{}, fmt.Errorf("missing %s", name)
+		}
+	}
+	rs.Duration = durs["dur"]
+
+	period := durs["period"]
+	switch kind {
+	case "const":
+		rate := rates["rate"]
+		rs.Rate = func(time.Duration) float64 { return rate }
+	case "ramp":
+		from, to := rates["from"], rates["to"]
+		rs.Rate = func(t time.Duration) float64 {
+			return from + (to-from)*float64(t)/float64(rs.Duration)
+		}
+	case "burst", "square":
+		low, high, width := rates["base"], rates["peak"], durs["width"]
+		if kind == "square" {
+			low, high, width = rates["low"], rates["high"], period/2
+		}
+		if width > period {
+			return RateSegment{}, fmt.Errorf("width exceeds period")
+		}
+		rs.Rate = func(t time.Duration) float64 {
+			if t%period < width {
+				return high
+			}
+			return low
+		}
+	case "sine":
+		mean, amp := rates["mean"], rates["amp"]
+		if amp > mean {
+			return RateSegment{}, fmt.Errorf("amp exceeds mean")
+		}
+		rs.Rate = func(t time.Duration) float64 {
+			return mean + amp*math.Sin(2*math.Pi*float64(t)/float64(period))
+		}
+	}
+	return rs, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcbench
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateSchedule(t *testing.T) {
+	s, err := ParseRateSchedule("const:rate=1MB,dur=1s; ramp:from=0B,to=10MB,dur=2s,name=up; square:low=1MB,high=2MB,period=100ms,dur=1s; sine:mean=4MB,amp=2MB,period=1s,dur=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s[0].Name != "const0" || s[1].Name != "up" {
+		t.Errorf("segment names are %q, %q; want const0, up", s[0].Name, s[1].Name)
+	}
+	ms := time.Millisecond
+	for _, test := range []struct {
+		t    time.Duration
+		want float64
+	}{
+		{500 * ms, 1e6},
+		{2 * time.Second, 5e6},
+		{3*time.Second + 10*ms, 2e6},
+		{3*time.Second + 60*ms, 1e6},
+		{4*time.Second + 250*ms, 6e6},
+		// The schedule repeats.
+		{5*time.Second + 500*ms, 1e6},
+	} {
+		if got := s.Rate(test.t); got < test.want-1 || got > test.want+1 {
+			t.Errorf("Rate(%v) = %v, want %v", test.t, got, test.want)
+		}
+	}
+
+	for spec, want := range map[string]string{
+		"":                                       "no segments",
+		"const:rate=1MB":                         "missing dur",
+		"const:dur=1s":                           "missing rate",
+		"wave:dur=1s":                            "unknown kind",
+		"const:rate=1MB,dur=1s,amp=1MB":          "unknown param",
+		"const:rate=fast,dur=1s":                 "bad value",
+		"sine:mean=1MB,amp=2MB,period=1s,dur=1s": "amp exceeds mean",
+	} {
+		_, err := ParseRateSchedule(spec)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseRateSchedule(%q): want error containing %q, got %v", spec, want, err)
+		}
+	}
+}
+
+func TestPhaseRuns(t *testing.T) {
+	sec := time.Second
+	run := RunInfo{
+		Trace:  GCTrace{{N: 1, Start: 1 * sec}, {N: 2, Start: 3 * sec}, {N: 3, Start: 5 * sec}, {N: 4, Start: 7 * sec}},
+		Phases: []Phase{{"a", 0}, {"b", 2 * sec}, {"a", 4 * sec}, {"c", 6 * sec}},
+	}
+	runs := phaseRuns(run)
+	for name, want := range map[string][]int{"a": {1, 3}, "b": {2}, "c": {4}} {
+		var got []int
+		for _, c := range runs[name].Trace {
+			got = append(got, c.N)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("phase %s has cycles %v, want %v", name, got, want)
+		}
+	}
+}